@@ -0,0 +1,94 @@
+package rfsb
+
+import (
+	"path/filepath"
+)
+
+// InferDependencies adds the dependencies implied by what the built in resources refer to:
+//
+//  - FileResources and DirectoryResources depend on the UserResource with their UID, the GroupResource with their
+//    GID, and any DirectoryResource that is an ancestor of their path
+//  - GroupMembershipResources depend on the GroupResource with their GID and the UserResource with their user name
+//
+// Each inferred dependency waits for the Evaluated signal. No dependency is inferred between two resources that
+// already have a dependency between them, in either direction. Inferred dependencies are marked as such in
+// Dependencies, Dependents, exports and reports. The inferred dependencies are returned.
+//
+// InferDependencies is called by Validate (and so by Materialize and Plan) if the ResourceGraph has AutoRequire set.
+func (rg *ResourceGraph) InferDependencies() []Edge {
+	rg.init()
+	users := map[uint32]Resource{}
+	usersByName := map[string]Resource{}
+	groups := map[uint32]Resource{}
+	directories := map[string]Resource{}
+	for _, r := range rg.resources {
+		switch r := r.(type) {
+		case *UserResource:
+			users[r.UID] = r
+			usersByName[r.User] = r
+		case *GroupResource:
+			groups[r.GID] = r
+		case *DirectoryResource:
+			directories[filepath.Clean(r.Path)] = r
+		}
+	}
+
+	inferred := []Edge{}
+	require := func(from Resource, to Resource) {
+		if from == nil || from == to {
+			return
+		}
+		if _, ok := rg.dependencies[from][to]; ok {
+			return
+		}
+		if _, ok := rg.dependencies[to][from]; ok {
+			return
+		}
+		rg.RegisterDependency(from, Evaluated, to)
+		if _, ok := rg.inferred[to]; !ok {
+			rg.inferred[to] = map[Resource]struct{}{}
+		}
+		rg.inferred[to][from] = struct{}{}
+		inferred = append(inferred, rg.edge(from, to))
+	}
+	requireOwnerAndParents := func(r Resource, path string, uid, gid uint32) {
+		require(users[uid], r)
+		require(groups[gid], r)
+		for _, parent := range ancestors(path) {
+			require(directories[parent], r)
+		}
+	}
+
+	for _, r := range rg.resources {
+		switch r := r.(type) {
+		case *FileResource:
+			requireOwnerAndParents(r, r.Path, r.UID, r.GID)
+		case *DirectoryResource:
+			requireOwnerAndParents(r, r.Path, r.UID, r.GID)
+		case *GroupMembershipResource:
+			require(groups[r.GID], r)
+			require(usersByName[r.User], r)
+		}
+	}
+	for _, edge := range inferred {
+		edge.To.Logger().Debugf("inferred dependency on %v", edge.From.Name())
+	}
+	return inferred
+}
+
+// ancestors returns every ancestor directory of the path, from the root down
+func ancestors(path string) []string {
+	dirs := []string{}
+	for dir := filepath.Dir(filepath.Clean(path)); ; dir = filepath.Dir(dir) {
+		dirs = append([]string{dir}, dirs...)
+		if dir == filepath.Dir(dir) {
+			return dirs
+		}
+	}
+}
+
+// isInferred returns true if the dependency was added by InferDependencies
+func (rg *ResourceGraph) isInferred(from, to Resource) bool {
+	_, ok := rg.inferred[to][from]
+	return ok
+}
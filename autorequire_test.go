@@ -0,0 +1,73 @@
+package rfsb
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInferDependencies(t *testing.T) {
+	t.Parallel()
+
+	rg := &ResourceGraph{}
+	user := &UserResource{User: "lcm", UID: 1000, GID: 1000, Home: "/home/lcm"}
+	rg.Register("user", user)
+	group := &GroupResource{Group: "lcm", GID: 1000}
+	rg.Register("group", group)
+	membership := &GroupMembershipResource{GID: 1000, User: "lcm"}
+	rg.Register("membership", membership)
+	home := &DirectoryResource{Path: "/home/lcm/", UID: 1000, GID: 1000, Mode: 0750}
+	rg.Register("home", home)
+	config := &DirectoryResource{Path: "/home/lcm/.config", UID: 1000, GID: 1000, Mode: 0750}
+	rg.When(user).Do("config", config)
+	file := &FileResource{Path: "/home/lcm/.config/rc", UID: 1000, GID: 1000, Mode: 0644}
+	rg.Register("file", file)
+	other := &FileResource{Path: "/etc/motd", UID: 0, GID: 0, Mode: 0644}
+	rg.Register("other", other)
+
+	inferred := rg.InferDependencies()
+	assert.Equal(t, []Edge{
+		{From: group, To: membership, Signals: []Signal{Evaluated}, Inferred: true},
+		{From: user, To: membership, Signals: []Signal{Evaluated}, Inferred: true},
+		{From: user, To: home, Signals: []Signal{Evaluated}, Inferred: true},
+		{From: group, To: home, Signals: []Signal{Evaluated}, Inferred: true},
+		{From: group, To: config, Signals: []Signal{Evaluated}, Inferred: true},
+		{From: home, To: config, Signals: []Signal{Evaluated}, Inferred: true},
+		{From: user, To: file, Signals: []Signal{Evaluated}, Inferred: true},
+		{From: group, To: file, Signals: []Signal{Evaluated}, Inferred: true},
+		{From: home, To: file, Signals: []Signal{Evaluated}, Inferred: true},
+		{From: config, To: file, Signals: []Signal{Evaluated}, Inferred: true},
+	}, inferred)
+	assert.Equal(t, []Edge{
+		{From: user, To: config, Signals: []Signal{Evaluated}},
+		{From: group, To: config, Signals: []Signal{Evaluated}, Inferred: true},
+		{From: home, To: config, Signals: []Signal{Evaluated}, Inferred: true},
+	}, rg.Dependencies(config))
+	assert.Empty(t, rg.Dependencies(other))
+
+	// A second pass finds nothing new
+	assert.Empty(t, rg.InferDependencies())
+}
+
+func TestAutoRequire(t *testing.T) {
+	t.Parallel()
+
+	rg := &ResourceGraph{}
+	file := &FileResource{Path: "/srv/app/config", UID: 1000, Mode: 0644}
+	rg.Register("file", file)
+	dir := &DirectoryResource{Path: "/srv/app", Mode: 0755}
+	rg.Register("dir", dir)
+
+	require.NoError(t, rg.Validate())
+	assert.Empty(t, rg.Dependencies(file))
+
+	rg.AutoRequire = true
+	require.NoError(t, rg.Validate())
+	assert.Equal(t, []Edge{{From: dir, To: file, Signals: []Signal{Evaluated}, Inferred: true}}, rg.Dependencies(file))
+
+	buf := &bytes.Buffer{}
+	require.NoError(t, rg.WriteDOT(buf))
+	assert.Contains(t, buf.String(), `"r1" -> "r0" [label="Evaluated", style=dashed];`)
+}
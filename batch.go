@@ -0,0 +1,242 @@
+package rfsb
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Batchable should be implemented by resources that are cheaper to materialize together than one at a time, such as
+// several edits to /etc/group, or several packages installed by a single package manager invocation.
+//
+// When a Batchable resource is to be materialized (its dependencies have been met, and ShouldSkip returned false), it
+// waits for the other resources of the same type and BatchKey that have also been released by their dependencies, and
+// MaterializeBatch is called once for all of them. Each resource is still reported, and emits its signals, separately.
+type Batchable interface {
+	Resource
+	// BatchKey returns the key identifying which resources of the same type can be materialized together
+	BatchKey() string
+	// MaterializeBatch materializes the passed resources, which all have the same type and BatchKey as the receiver. It
+	// returns the error for each resource (nil if it was materialized), in the same order. The context is that of the
+	// whole run, so custom signals can not be emitted.
+	//
+	// A resource's RetryPolicy Timeout covers its ShouldSkip call and its wait for the rest of the batch, but not the
+	// call to MaterializeBatch. If the timeout expires while the resource is waiting, it leaves the batch and the
+	// attempt fails, as any other timed out attempt would.
+	MaterializeBatch(ctx context.Context, batch []Resource) []error
+}
+
+// batchKey identifies the resources that can be batched together
+type batchKey struct {
+	kind reflect.Type
+	key  string
+}
+
+func batchKeyOf(r Batchable) batchKey {
+	return batchKey{kind: reflect.TypeOf(r), key: r.BatchKey()}
+}
+
+// batch is a set of resources waiting to be materialized together. started is the time MaterializeBatch was called.
+type batch struct {
+	members []Batchable
+	started time.Time
+	errs    map[Batchable]error
+	done    chan struct{}
+}
+
+// batcher groups Batchable resources into batches. A batch is materialized once every resource with its key that has
+// been released by its dependencies, and has not yet finished, has joined it.
+type batcher struct {
+	ctx context.Context
+	// materialize materializes the batch, setting its start time and the error for each resource
+	materialize func(context.Context, *batch)
+
+	lock     sync.Mutex
+	inFlight map[batchKey]int
+	open     map[batchKey]*batch
+}
+
+func newBatcher(ctx context.Context, materialize func(context.Context, *batch)) *batcher {
+	return &batcher{
+		ctx:         ctx,
+		materialize: materialize,
+		inFlight:    map[batchKey]int{},
+		open:        map[batchKey]*batch{},
+	}
+}
+
+// released records that the resource's dependencies have been met, so that batches with its key wait for it
+func (b *batcher) released(r Batchable) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.inFlight[batchKeyOf(r)]++
+}
+
+// finished records that the resource has finished, so that batches with its key no longer wait for it
+func (b *batcher) finished(r Batchable) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	key := batchKeyOf(r)
+	b.inFlight[key]--
+	b.flushIfReady(key)
+}
+
+// join adds the resource to the open batch with its key, and blocks until the batch has been materialized, returning
+// the time the batch started being materialized, and the resource's error. If the context is cancelled before the
+// batch is materialized, the resource leaves the batch.
+func (b *batcher) join(ctx context.Context, r Batchable) (time.Time, error) {
+	b.lock.Lock()
+	key := batchKeyOf(r)
+	joined, ok := b.open[key]
+	if !ok {
+		joined = &batch{done: make(chan struct{})}
+		b.open[key] = joined
+	}
+	joined.members = append(joined.members, r)
+	b.flushIfReady(key)
+	b.lock.Unlock()
+
+	select {
+	case <-joined.done:
+		return joined.started, joined.errs[r]
+	case <-ctx.Done():
+	}
+	if b.leave(key, joined, r) {
+		return time.Time{}, ctx.Err()
+	}
+	// The batch was already being materialized, so its result stands
+	<-joined.done
+	return joined.started, joined.errs[r]
+}
+
+// leave removes the resource from the batch, returning false if the batch is no longer open
+func (b *batcher) leave(key batchKey, joined *batch, r Batchable) bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.open[key] != joined {
+		return false
+	}
+	members := []Batchable{}
+	for _, member := range joined.members {
+		if member != r {
+			members = append(members, member)
+		}
+	}
+	joined.members = members
+	if len(members) == 0 {
+		delete(b.open, key)
+	}
+	return true
+}
+
+// flushIfReady starts materializing the open batch with the key if every resource in flight has joined it. It must be
+// called with the lock held.
+func (b *batcher) flushIfReady(key batchKey) {
+	ready, ok := b.open[key]
+	if !ok || len(ready.members) != b.inFlight[key] {
+		return
+	}
+	delete(b.open, key)
+	go func() {
+		b.materialize(b.ctx, ready)
+		close(ready.done)
+	}()
+}
+
+// materializeBatchable prepares the resource under its slot and locks, and then materializes it as part of a batch
+func (e *execution) materializeBatchable(ctx context.Context, resource Batchable) (Signal, error) {
+	free, release, err := e.acquire(ctx, resource)
+	if err != nil {
+		return Unevaluated, err
+	}
+	shouldSkip, err := e.prepare(ctx, resource)
+	release()
+	free()
+	if err != nil {
+		return Unevaluated, err
+	}
+	if shouldSkip {
+		return Skipped, nil
+	}
+
+	resource.Logger().Debugf("waiting for batch")
+	queued := time.Now()
+	started, err := e.batches.join(ctx, resource)
+	if started.IsZero() {
+		started = time.Now()
+	}
+	record := e.records[resource]
+	record.Queued = append(record.Queued, Span{Start: queued, End: started})
+	if err != nil {
+		return Unevaluated, err
+	}
+	return Materialized, nil
+}
+
+// materializeBatch calls MaterializeBatch for the resources, holding the locks of all of them. The batch takes a single
+// slot, that of its first resource.
+func (e *execution) materializeBatch(ctx context.Context, ready *batch) {
+	members := ready.members
+	errs := make(map[Batchable]error, len(members))
+	ready.errs = errs
+	failAll := func(err error) {
+		for _, member := range members {
+			errs[member] = err
+		}
+	}
+	free, _, err := e.slots.acquire(ctx, members[0])
+	if err != nil {
+		failAll(err)
+		return
+	}
+	defer free()
+	keys := []string{}
+	for _, member := range members {
+		if locker, ok := member.(Locker); ok {
+			keys = append(keys, locker.LockKeys()...)
+		}
+	}
+	release, _, err := e.locks.acquireKeys(ctx, keys)
+	if err != nil {
+		failAll(err)
+		return
+	}
+	defer release()
+	ready.started = time.Now()
+
+	batch := []Resource{}
+	for _, member := range members {
+		if e.graph.Transactional {
+			if err := e.snapshot(ctx, member); err != nil {
+				errs[member] = err
+				continue
+			}
+		}
+		batch = append(batch, member)
+	}
+	if len(batch) == 0 {
+		return
+	}
+
+	for _, r := range batch {
+		r.Logger().Infof("materializing resource in a batch of %d", len(batch))
+		e.observers.MaterializeStarted(r)
+	}
+	batchErrs := batch[0].(Batchable).MaterializeBatch(ctx, batch)
+	if len(batchErrs) != len(batch) {
+		err := errors.Errorf("MaterializeBatch returned %d errors for %d resources", len(batchErrs), len(batch))
+		batchErrs = make([]error, len(batch))
+		for i := range batchErrs {
+			batchErrs[i] = err
+		}
+	}
+	for i, r := range batch {
+		e.observers.MaterializeFinished(r, batchErrs[i])
+		if batchErrs[i] != nil {
+			errs[r.(Batchable)] = errors.Wrapf(batchErrs[i], "could not materialize resource %v", r.Name())
+		}
+	}
+}
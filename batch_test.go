@@ -0,0 +1,177 @@
+package rfsb
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// batchRecorder records the names of the resources in each batch materialized
+type batchRecorder struct {
+	lock    sync.Mutex
+	batches [][]string
+}
+
+func (br *batchRecorder) record(batch []Resource) {
+	br.lock.Lock()
+	defer br.lock.Unlock()
+	names := []string{}
+	for _, r := range batch {
+		names = append(names, r.Name())
+	}
+	sort.Strings(names)
+	br.batches = append(br.batches, names)
+}
+
+// batchResource is a Batchable resource whose ShouldSkip blocks until all resources sharing its ready group have been
+// released, so that they are all batched together. If set, entered is closed when ShouldSkip is called, and ShouldSkip
+// then blocks until proceed is closed.
+type batchResource struct {
+	ResourceMeta
+	key      string
+	err      error
+	ready    *sync.WaitGroup
+	entered  chan struct{}
+	proceed  chan struct{}
+	recorder *batchRecorder
+}
+
+func (br *batchResource) ShouldSkip(context.Context) (bool, error) {
+	if br.entered != nil {
+		close(br.entered)
+	}
+	if br.ready != nil {
+		br.ready.Done()
+		br.ready.Wait()
+	}
+	if br.proceed != nil {
+		<-br.proceed
+	}
+	return false, nil
+}
+
+func (br *batchResource) Materialize(context.Context) error {
+	br.recorder.record([]Resource{br})
+	return br.err
+}
+
+func (br *batchResource) BatchKey() string {
+	return br.key
+}
+
+func (br *batchResource) MaterializeBatch(ctx context.Context, batch []Resource) []error {
+	br.recorder.record(batch)
+	errs := []error{}
+	for _, r := range batch {
+		errs = append(errs, r.(*batchResource).err)
+	}
+	return errs
+}
+
+func TestResourceGraphBatchable(t *testing.T) {
+	t.Parallel()
+
+	recorder := &batchRecorder{}
+	ready := &sync.WaitGroup{}
+	ready.Add(4)
+	rg := &ResourceGraph{KeepGoing: true}
+	first := &testResource{}
+	rg.Register("first", first)
+	a := &batchResource{ready: ready, recorder: recorder}
+	b := &batchResource{ready: ready, recorder: recorder, err: errors.New("failed")}
+	c := &batchResource{ready: ready, recorder: recorder}
+	other := &batchResource{key: "other", ready: ready, recorder: recorder}
+	rg.When(first).Do("a", a)
+	rg.When(first).Do("b", b)
+	rg.When(first).Do("c", c)
+	rg.When(first).Do("other", other)
+	afterA := &testResource{}
+	rg.When(a, Materialized).Do("afterA", afterA)
+	afterB := &testResource{}
+	rg.When(b, Materialized).Do("afterB", afterB)
+	// later depends on a member of the batch, so is materialized in a batch of its own
+	later := &batchResource{recorder: recorder}
+	rg.When(c).Do("later", later)
+
+	report, err := rg.MaterializeWithReport(context.Background())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "could not materialize resource b: failed")
+
+	sort.Slice(recorder.batches, func(i, j int) bool { return recorder.batches[i][0] < recorder.batches[j][0] })
+	assert.Equal(t, [][]string{{"a", "b", "c"}, {"later"}, {"other"}}, recorder.batches)
+	signals := map[string]Signal{}
+	for _, resource := range report.Resources {
+		signals[resource.Name] = resource.Signal
+	}
+	assert.Equal(t, Materialized, signals["a"])
+	assert.Equal(t, Failed, signals["b"])
+	assert.Equal(t, Materialized, signals["c"])
+	assert.Equal(t, Materialized, signals["later"])
+	assert.Equal(t, int32(1), afterA.materialized)
+	assert.Equal(t, int32(0), afterB.materialized)
+}
+
+func TestResourceGraphBatchablePlan(t *testing.T) {
+	t.Parallel()
+
+	recorder := &batchRecorder{}
+	rg := &ResourceGraph{}
+	batched := &batchResource{recorder: recorder}
+	rg.Register("batched", batched)
+	// Plan does not materialize, so never batches
+	_, err := rg.Plan(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, recorder.batches)
+
+	require.NoError(t, rg.Materialize(context.Background()))
+	assert.Equal(t, [][]string{{"batched"}}, recorder.batches)
+}
+
+// failureObserver closes failed once a Resource has failed
+type failureObserver struct {
+	NopObserver
+	failed chan struct{}
+}
+
+func (fo *failureObserver) ResourceFailed(Resource, error) {
+	close(fo.failed)
+}
+
+func TestResourceGraphBatchableTimeout(t *testing.T) {
+	t.Parallel()
+
+	recorder := &batchRecorder{}
+	failures := &failureObserver{failed: make(chan struct{})}
+	rg := &ResourceGraph{KeepGoing: true, Observers: []Observer{failures}}
+	// slow is held in ShouldSkip until the test releases it, so the batch waits for it
+	slowEntered := make(chan struct{})
+	release := make(chan struct{})
+	slow := &batchResource{entered: slowEntered, proceed: release, recorder: recorder}
+	rg.Register("slow", slow)
+	impatient := &batchResource{proceed: slowEntered, recorder: recorder}
+	impatient.Retry = RetryPolicy{Timeout: 10 * time.Millisecond}
+	rg.Register("impatient", impatient)
+
+	done := make(chan struct{})
+	var report *RunReport
+	var err error
+	go func() {
+		defer close(done)
+		report, err = rg.MaterializeWithReport(context.Background())
+	}()
+	<-failures.failed
+	close(release)
+	<-done
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), context.DeadlineExceeded.Error())
+	assert.Equal(t, Materialized, report.Resources[0].Signal)
+	assert.Equal(t, Failed, report.Resources[1].Signal)
+	assert.Equal(t, [][]string{{"slow"}}, recorder.batches)
+}
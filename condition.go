@@ -0,0 +1,66 @@
+package rfsb
+
+import (
+	"context"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Condition decides at run time whether a Resource should be evaluated. See DependencySetter.If
+type Condition func(context.Context) (bool, error)
+
+// condition is a Condition registered for a target of Do. If the target is a ResourceGraph, the condition gates each
+// of the graph's root resources, but is only checked once per run.
+type condition struct {
+	check Condition
+}
+
+// conditionResult is the outcome of checking a condition during a run
+type conditionResult struct {
+	once sync.Once
+	met  bool
+	err  error
+}
+
+func (rg *ResourceGraph) registerCondition(to Resource, check Condition) {
+	rg.init()
+	cond := &condition{check: check}
+	for _, to := range targetResources(to) {
+		rg.conditions[to] = append(rg.conditions[to], cond)
+	}
+}
+
+// checkConditions checks each of the resource's conditions in turn, stopping at the first that is not met. Conditions
+// shared with other resources are only checked by the first resource to reach them.
+func (e *execution) checkConditions(ctx context.Context, resource Resource) (bool, error) {
+	for _, cond := range e.graph.conditions[resource] {
+		result := e.conditionResult(cond)
+		result.once.Do(func() {
+			result.met, result.err = cond.check(ctx)
+		})
+		if result.err != nil {
+			return false, errors.Wrapf(result.err, "could not check condition for %v", resource.Name())
+		}
+		if !result.met {
+			resource.Logger().Infof("skipping as condition was not met")
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// conditionResult returns the result of the condition for this run, which may not have been checked yet
+func (e *execution) conditionResult(cond *condition) *conditionResult {
+	e.conditionsLock.Lock()
+	defer e.conditionsLock.Unlock()
+	if e.conditionResults == nil {
+		e.conditionResults = map[*condition]*conditionResult{}
+	}
+	result, ok := e.conditionResults[cond]
+	if !ok {
+		result = &conditionResult{}
+		e.conditionResults[cond] = result
+	}
+	return result
+}
@@ -21,9 +21,37 @@ func When(source Resource, signals ...Signal) *DependencySetter {
 	return DefaultRegistry.When(source, signals...)
 }
 
+// Notify registers the handler to be notified when the notifier is materialized, using the DefaultRegistry
+//
+// Notify is a shortcut for DefaultRegistry.Notify. See there for more details
+func Notify(notifier Resource, handler Resource) {
+	DefaultRegistry.Notify(notifier, handler)
+}
+
 // Materialize materializes the resources registered with the DefaultRegistry
 //
 // Materialize is a shortcut for DefaultRegistry.Materialize. See there for more details
 func Materialize(ctx context.Context) error {
 	return DefaultRegistry.Materialize(ctx)
 }
+
+// MaterializeWithReport materializes the resources registered with the DefaultRegistry, returning a report of the run
+//
+// MaterializeWithReport is a shortcut for DefaultRegistry.MaterializeWithReport. See there for more details
+func MaterializeWithReport(ctx context.Context) (*RunReport, error) {
+	return DefaultRegistry.MaterializeWithReport(ctx)
+}
+
+// Validate checks the resources registered with the DefaultRegistry for problems
+//
+// Validate is a shortcut for DefaultRegistry.Validate. See there for more details
+func Validate() error {
+	return DefaultRegistry.Validate()
+}
+
+// Lookup returns the Resource registered with the DefaultRegistry with the passed hierarchical name
+//
+// Lookup is a shortcut for DefaultRegistry.Lookup. See there for more details
+func Lookup(name string) (Resource, bool) {
+	return DefaultRegistry.Lookup(name)
+}
@@ -0,0 +1,74 @@
+package rfsb
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+)
+
+// Differ should be implemented by resources that can describe the changes Materialize will make. When a Differ is
+// materialized, the ResourceGraph logs the Diff, and includes it in any Plan or RunReport.
+type Differ interface {
+	Resource
+	Diff(context.Context) (*Diff, error)
+}
+
+// FieldDiff describes a single attribute of a resource that does not have the desired value
+type FieldDiff struct {
+	Field   string `json:"field"`
+	Current string `json:"current"`
+	Desired string `json:"desired"`
+}
+
+func (fd FieldDiff) String() string {
+	return fmt.Sprintf("%s: %q -> %q", fd.Field, fd.Current, fd.Desired)
+}
+
+// Diff describes how the current state of a resource differs from its desired state
+type Diff struct {
+	// Missing is true when the object managed by the resource does not exist at all
+	Missing bool `json:"missing,omitempty"`
+	// Fields lists the attributes that do not have their desired values
+	Fields []FieldDiff `json:"fields,omitempty"`
+	// Content is a unified diff of the content managed by the resource, if it has changed
+	Content string `json:"content,omitempty"`
+}
+
+// Empty returns true if the Diff contains no changes
+func (d *Diff) Empty() bool {
+	return !d.Missing && len(d.Fields) == 0 && d.Content == ""
+}
+
+func (d *Diff) String() string {
+	buf := &bytes.Buffer{}
+	if d.Missing {
+		buf.WriteString("does not exist\n")
+	}
+	for _, field := range d.Fields {
+		buf.WriteString(field.String())
+		buf.WriteByte('\n')
+	}
+	buf.WriteString(d.Content)
+	return buf.String()
+}
+
+// diffResource returns the resource's Diff if it implements Differ. Errors are logged rather than returned, as the
+// Diff is informational only.
+func diffResource(ctx context.Context, resource Resource) *Diff {
+	differ, ok := resource.(Differ)
+	if !ok {
+		return nil
+	}
+	diff, err := differ.Diff(ctx)
+	if err != nil {
+		resource.Logger().Warnf("could not compute diff: %v", err)
+		return nil
+	}
+	if diff == nil {
+		return nil
+	}
+	if !diff.Empty() {
+		resource.Logger().Infof("changes:\n%s", diff)
+	}
+	return diff
+}
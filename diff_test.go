@@ -0,0 +1,103 @@
+package rfsb
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	_ Differ = &FileResource{}
+	_ Differ = &UserResource{}
+	_ Differ = &GroupResource{}
+	_ Differ = &GroupMembershipResource{}
+)
+
+func TestFileResourceDiff(t *testing.T) {
+	t.Parallel()
+
+	scratchDir, err := ioutil.TempDir("", t.Name())
+	if err != nil {
+		t.Skipf("could not create test dir: %v", err)
+	}
+
+	fr := &FileResource{
+		Path:     scratchDir + "/file",
+		Contents: "one\ntwo\n",
+		Mode:     0644,
+		UID:      uint32(os.Getuid()),
+		GID:      uint32(os.Getgid()),
+	}
+	fr.SetName("file")
+
+	diff, err := fr.Diff(context.Background())
+	require.NoError(t, err)
+	assert.True(t, diff.Missing)
+	assert.Contains(t, diff.Content, "+one\n+two\n")
+
+	require.NoError(t, fr.Materialize(context.Background()))
+	diff, err = fr.Diff(context.Background())
+	require.NoError(t, err)
+	assert.True(t, diff.Empty())
+
+	fr.Contents = "one\nthree\n"
+	fr.Mode = 0600
+	diff, err = fr.Diff(context.Background())
+	require.NoError(t, err)
+	assert.False(t, diff.Missing)
+	assert.Equal(t, []FieldDiff{{Field: "mode", Current: "-rw-r--r--", Desired: "-rw-------"}}, diff.Fields)
+	assert.Contains(t, diff.Content, "-two\n+three\n")
+}
+
+func TestSkippingWrapperForwardsDiffAndLockKeys(t *testing.T) {
+	t.Parallel()
+
+	fr := &FileResource{Path: "/nonexistent/file", Contents: "one\n"}
+	wrapped := &SkippingWrapper{Resource: fr}
+	wrapped.SetName("file")
+	assert.Equal(t, []string{"/nonexistent/file"}, wrapped.LockKeys())
+	diff := diffResource(context.Background(), wrapped)
+	require.NotNil(t, diff)
+	assert.True(t, diff.Missing)
+
+	plain := &SkippingWrapper{Resource: &testResource{}}
+	plain.SetName("plain")
+	assert.Empty(t, plain.LockKeys())
+	assert.Nil(t, diffResource(context.Background(), plain))
+}
+
+func TestUserResourceDiff(t *testing.T) {
+	t.Parallel()
+
+	passwd := "root:x:0:0::/root:/bin/bash\nlcm:x:1000:1000::/home/lcm:/bin/sh\n"
+	ur := &UserResource{User: "lcm", UID: 1000, GID: 1000, Home: "/home/lcm", Shell: "/bin/bash"}
+	assert.Equal(t, []FieldDiff{{Field: "shell", Current: "/bin/sh", Desired: "/bin/bash"}}, ur.diffPasswd(passwd).Fields)
+
+	ur = &UserResource{User: "mongodb", UID: 1001, GID: 1001, Home: "/var/lib/mongodb", Shell: "/bin/bash"}
+	assert.True(t, ur.diffPasswd(passwd).Missing)
+}
+
+func TestGroupResourceDiff(t *testing.T) {
+	t.Parallel()
+
+	group := "root:x:0:\nlcm:x:1000:\nsudo:x:150:root\n"
+	gr := &GroupResource{Group: "admins", GID: 1000}
+	assert.Equal(t, []FieldDiff{{Field: "group", Current: "lcm", Desired: "admins"}}, gr.diffGroup(group).Fields)
+
+	gr = &GroupResource{Group: "mongodb", GID: 1001}
+	assert.True(t, gr.diffGroup(group).Missing)
+
+	gmr := &GroupMembershipResource{GID: 150, User: "lcm"}
+	diff, err := gmr.diffGroup(group)
+	require.NoError(t, err)
+	assert.Equal(t, []FieldDiff{{Field: "members", Current: "root", Desired: "root,lcm"}}, diff.Fields)
+
+	gmr = &GroupMembershipResource{GID: 150, User: "root"}
+	diff, err = gmr.diffGroup(group)
+	require.NoError(t, err)
+	assert.True(t, diff.Empty())
+}
@@ -117,12 +117,12 @@ func main() {
 	addMongodb := mongodb()
 	rfsb.When(addUsers).Do("mongo", addMongodb)
 
-	// err := rfsb.Validate()
-	// if err != nil {
-	// 	logrus.Fatal("failed to validate resource graph: ", err)
-	// }
+	err := rfsb.Validate()
+	if err != nil {
+		logrus.Fatal("failed to validate resource graph: ", err)
+	}
 
-	err := rfsb.Materialize(context.Background())
+	err = rfsb.Materialize(context.Background())
 	if err != nil {
 		logrus.Fatal("failed to materialize changes: ", err)
 	}
@@ -0,0 +1,130 @@
+package rfsb
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// WriteDOT writes the ResourceGraph to the writer in the Graphviz DOT format. Nested ResourceGraphs are rendered as
+// clusters containing a node for the graph itself, and each dependency is labelled with the signals it waits for.
+// Dependencies added by InferDependencies are dashed.
+func (rg *ResourceGraph) WriteDOT(w io.Writer) error {
+	ids := rg.exportIDs()
+	buf := bufio.NewWriter(w)
+
+	name := rg.Name()
+	if name == "" {
+		name = "rfsb"
+	}
+	fmt.Fprintf(buf, "digraph %q {\n", name)
+	cluster := 0
+	var writeGraph func(g *ResourceGraph, indent string)
+	writeGraph = func(g *ResourceGraph, indent string) {
+		for _, sub := range g.subgraphs {
+			fmt.Fprintf(buf, "%ssubgraph \"cluster_%d\" {\n", indent, cluster)
+			fmt.Fprintf(buf, "%s\tlabel = %q;\n", indent, sub.Name())
+			cluster++
+			writeGraph(sub, indent+"\t")
+			fmt.Fprintf(buf, "%s\t%q [label=%q, shape=box];\n", indent, ids[sub], sub.Name())
+			fmt.Fprintf(buf, "%s}\n", indent)
+		}
+		for _, r := range g.directResources() {
+			fmt.Fprintf(buf, "%s%q [label=%q];\n", indent, ids[r], r.Name())
+		}
+	}
+	writeGraph(rg, "\t")
+	rg.exportEdges(ids, func(from, to string, label string, inferred bool) {
+		if inferred {
+			fmt.Fprintf(buf, "\t%q -> %q [label=%q, style=dashed];\n", from, to, label)
+		} else {
+			fmt.Fprintf(buf, "\t%q -> %q [label=%q];\n", from, to, label)
+		}
+	})
+	buf.WriteString("}\n")
+	return buf.Flush()
+}
+
+// WriteMermaid writes the ResourceGraph to the writer as a Mermaid flowchart. Nested ResourceGraphs are rendered as
+// subgraphs containing a node for the graph itself, and each dependency is labelled with the signals it waits for.
+// Dependencies added by InferDependencies are dotted.
+func (rg *ResourceGraph) WriteMermaid(w io.Writer) error {
+	ids := rg.exportIDs()
+	buf := bufio.NewWriter(w)
+
+	buf.WriteString("graph TD\n")
+	cluster := 0
+	var writeGraph func(g *ResourceGraph, indent string)
+	writeGraph = func(g *ResourceGraph, indent string) {
+		for _, sub := range g.subgraphs {
+			fmt.Fprintf(buf, "%ssubgraph c%d [\"%s\"]\n", indent, cluster, mermaidEscape(sub.Name()))
+			cluster++
+			writeGraph(sub, indent+"\t")
+			fmt.Fprintf(buf, "%s\t%s[[\"%s\"]]\n", indent, ids[sub], mermaidEscape(sub.Name()))
+			fmt.Fprintf(buf, "%send\n", indent)
+		}
+		for _, r := range g.directResources() {
+			fmt.Fprintf(buf, "%s%s[\"%s\"]\n", indent, ids[r], mermaidEscape(r.Name()))
+		}
+	}
+	writeGraph(rg, "\t")
+	rg.exportEdges(ids, func(from, to string, label string, inferred bool) {
+		if inferred {
+			fmt.Fprintf(buf, "\t%s -.->|%s| %s\n", from, mermaidEscape(label), to)
+		} else {
+			fmt.Fprintf(buf, "\t%s -->|%s| %s\n", from, mermaidEscape(label), to)
+		}
+	})
+	return buf.Flush()
+}
+
+func mermaidEscape(s string) string {
+	return strings.Replace(s, `"`, "#quot;", -1)
+}
+
+// exportIDs assigns a stable identifier to each resource, based on its position in the registration order
+func (rg *ResourceGraph) exportIDs() map[Resource]string {
+	ids := make(map[Resource]string, len(rg.resources))
+	for i, r := range rg.resources {
+		ids[r] = fmt.Sprintf("r%d", i)
+	}
+	return ids
+}
+
+// directResources returns the resources registered with the graph that were not registered via a nested graph. The
+// nested graphs themselves are also excluded.
+func (rg *ResourceGraph) directResources() []Resource {
+	nested := map[Resource]struct{}{}
+	for _, sub := range rg.subgraphs {
+		nested[sub] = struct{}{}
+		for _, r := range sub.resources {
+			nested[r] = struct{}{}
+		}
+	}
+	direct := []Resource{}
+	for _, r := range rg.resources {
+		if _, ok := nested[r]; !ok {
+			direct = append(direct, r)
+		}
+	}
+	return direct
+}
+
+// exportEdges calls the passed function for each dependency between registered resources, in registration order. The
+// dependencies of nested graphs on their own resources are omitted, as they are implied by the clusters.
+func (rg *ResourceGraph) exportEdges(ids map[Resource]string, edge func(from, to string, label string, inferred bool)) {
+	index := rg.resourceIndex()
+	for _, from := range rg.resources {
+		for _, to := range rg.sortedDependents(index, from) {
+			if isMembership(from, to) {
+				continue
+			}
+			labels := []string{}
+			for _, sig := range rg.dependencies[from][to] {
+				labels = append(labels, sig.String())
+			}
+			edge(ids[from], ids[to], strings.Join(labels, ", "), rg.isInferred(from, to))
+		}
+	}
+}
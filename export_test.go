@@ -0,0 +1,59 @@
+package rfsb
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func mkExportGraph() *ResourceGraph {
+	users := &ResourceGraph{}
+	group := &testResource{}
+	user := &testResource{}
+	users.Register("group", group)
+	users.When(group).Do("user", user)
+
+	rg := &ResourceGraph{}
+	rg.Register("users", users)
+	reload := &testResource{}
+	rg.When(users, Materialized).And(users, Skipped).Do("reload", reload)
+	return rg
+}
+
+func TestWriteDOT(t *testing.T) {
+	t.Parallel()
+
+	buf := &bytes.Buffer{}
+	require.NoError(t, mkExportGraph().WriteDOT(buf))
+	assert.Equal(t, `digraph "rfsb" {
+	subgraph "cluster_0" {
+		label = "users";
+		"r0" [label="users·group"];
+		"r1" [label="users·user"];
+		"r2" [label="users", shape=box];
+	}
+	"r3" [label="reload"];
+	"r0" -> "r1" [label="Evaluated"];
+	"r2" -> "r3" [label="Materialized, Skipped"];
+}
+`, buf.String())
+}
+
+func TestWriteMermaid(t *testing.T) {
+	t.Parallel()
+
+	buf := &bytes.Buffer{}
+	require.NoError(t, mkExportGraph().WriteMermaid(buf))
+	assert.Equal(t, `graph TD
+	subgraph c0 ["users"]
+		r0["users·group"]
+		r1["users·user"]
+		r2[["users"]]
+	end
+	r3["reload"]
+	r0 -->|Evaluated| r1
+	r2 -->|Materialized, Skipped| r3
+`, buf.String())
+}
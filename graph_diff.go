@@ -0,0 +1,355 @@
+package rfsb
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// GraphDiff describes the structural differences between two ResourceGraphs. Resources are identified by their
+// hierarchical names. It can be serialized to JSON.
+type GraphDiff struct {
+	// Added and Removed list the names of the resources only present in the new and old graph respectively
+	Added   []string `json:"added,omitempty"`
+	Removed []string `json:"removed,omitempty"`
+	// Changed lists the resources present in both graphs whose exported fields differ
+	Changed []ResourceChange `json:"changed,omitempty"`
+	// AddedEdges and RemovedEdges list the dependencies only present in the new and old graph respectively. If the
+	// signals of a dependency changed, the added and removed signals are listed separately.
+	AddedEdges   []EdgeChange `json:"added_edges,omitempty"`
+	RemovedEdges []EdgeChange `json:"removed_edges,omitempty"`
+}
+
+// ResourceChange describes a resource whose configuration differs between two ResourceGraphs. For each FieldDiff,
+// Current holds the value from the old graph, and Desired the value from the new graph.
+type ResourceChange struct {
+	Name   string      `json:"name"`
+	Fields []FieldDiff `json:"fields"`
+}
+
+// EdgeChange describes a dependency between two resources, identified by name
+type EdgeChange struct {
+	From    string   `json:"from"`
+	To      string   `json:"to"`
+	Signals []Signal `json:"signals"`
+}
+
+func (ec EdgeChange) String() string {
+	return fmt.Sprintf("%s -> %s (%s)", ec.From, ec.To, joinSignals(ec.Signals))
+}
+
+func joinSignals(signals []Signal) string {
+	buf := &bytes.Buffer{}
+	for i, sig := range signals {
+		if i != 0 {
+			buf.WriteString(", ")
+		}
+		buf.WriteString(sig.String())
+	}
+	return buf.String()
+}
+
+// Empty returns true if the two graphs are structurally identical
+func (gd *GraphDiff) Empty() bool {
+	return len(gd.Added) == 0 && len(gd.Removed) == 0 && len(gd.Changed) == 0 &&
+		len(gd.AddedEdges) == 0 && len(gd.RemovedEdges) == 0
+}
+
+func (gd *GraphDiff) String() string {
+	buf := &bytes.Buffer{}
+	for _, name := range gd.Added {
+		fmt.Fprintf(buf, "+ %s\n", name)
+	}
+	for _, name := range gd.Removed {
+		fmt.Fprintf(buf, "- %s\n", name)
+	}
+	for _, change := range gd.Changed {
+		fmt.Fprintf(buf, "~ %s\n", change.Name)
+		for _, field := range change.Fields {
+			fmt.Fprintf(buf, "    %s\n", field)
+		}
+	}
+	for _, edge := range gd.AddedEdges {
+		fmt.Fprintf(buf, "+ %s\n", edge)
+	}
+	for _, edge := range gd.RemovedEdges {
+		fmt.Fprintf(buf, "- %s\n", edge)
+	}
+	return buf.String()
+}
+
+// DiffGraphs compares two ResourceGraphs, such as the graph built by the last release (before) and the graph built by
+// the current commit (after). Resources are compared by their exported fields, including those of any embedded
+// structs, and of any structs (or Resources) they point to. Fields holding functions or channels are ignored.
+func DiffGraphs(before, after *ResourceGraph) *GraphDiff {
+	diff := &GraphDiff{}
+	oldByName := resourcesByName(before)
+	newByName := resourcesByName(after)
+
+	for _, r := range before.resources {
+		if _, ok := newByName[r.Name()]; !ok {
+			diff.Removed = append(diff.Removed, r.Name())
+		}
+	}
+	for _, r := range after.resources {
+		oldR, ok := oldByName[r.Name()]
+		if !ok {
+			diff.Added = append(diff.Added, r.Name())
+			continue
+		}
+		if fields := diffFields(oldR, r); len(fields) != 0 {
+			diff.Changed = append(diff.Changed, ResourceChange{Name: r.Name(), Fields: fields})
+		}
+	}
+
+	oldEdges := edgesByName(before)
+	newEdges := edgesByName(after)
+	diff.AddedEdges = subtractEdges(newEdges, oldEdges)
+	diff.RemovedEdges = subtractEdges(oldEdges, newEdges)
+	return diff
+}
+
+func resourcesByName(rg *ResourceGraph) map[string]Resource {
+	byName := make(map[string]Resource, len(rg.resources))
+	for _, r := range rg.resources {
+		byName[r.Name()] = r
+	}
+	return byName
+}
+
+// edgesByName returns the signals of every dependency in the graph, keyed by the names of the resources. The
+// dependencies of nested graphs on their own resources are omitted.
+func edgesByName(rg *ResourceGraph) map[[2]string][]Signal {
+	edges := map[[2]string][]Signal{}
+	for from, tos := range rg.dependencies {
+		for to, signals := range tos {
+			if isMembership(from, to) {
+				continue
+			}
+			key := [2]string{from.Name(), to.Name()}
+			edges[key] = append(edges[key], signals...)
+		}
+	}
+	return edges
+}
+
+// subtractEdges returns the signals in a that are not in b, sorted by the names of the resources
+func subtractEdges(a, b map[[2]string][]Signal) []EdgeChange {
+	changes := []EdgeChange{}
+	for key, signals := range a {
+		missing := []Signal{}
+		for _, sig := range signals {
+			if !containsSignal(b[key], sig) && !containsSignal(missing, sig) {
+				missing = append(missing, sig)
+			}
+		}
+		if len(missing) != 0 {
+			sort.Slice(missing, func(i, j int) bool { return missing[i] < missing[j] })
+			changes = append(changes, EdgeChange{From: key[0], To: key[1], Signals: missing})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].From != changes[j].From {
+			return changes[i].From < changes[j].From
+		}
+		return changes[i].To < changes[j].To
+	})
+	if len(changes) == 0 {
+		return nil
+	}
+	return changes
+}
+
+// diffFields compares the exported fields of two resources. Nested ResourceGraphs are not compared, as their fields
+// only take effect on the ResourceGraph that is materialized.
+func diffFields(before, after Resource) []FieldDiff {
+	return compareFields(before, after, false)
+}
+
+// diffState compares the exported fields of two resources that describe what they manage, ignoring those of their
+// embedded ResourceMeta, which only affect how they are run
+func diffState(before, after Resource) []FieldDiff {
+	return compareFields(before, after, true)
+}
+
+func compareFields(before, after Resource, skipMeta bool) []FieldDiff {
+	if reflect.TypeOf(before) != reflect.TypeOf(after) {
+		return []FieldDiff{{Field: "type", Current: fmt.Sprintf("%T", before), Desired: fmt.Sprintf("%T", after)}}
+	}
+	if _, ok := after.(*ResourceGraph); ok {
+		return nil
+	}
+
+	oldFields, names := exportedFields(reflect.ValueOf(before), skipMeta)
+	newFields, newNames := exportedFields(reflect.ValueOf(after), skipMeta)
+	for _, name := range newNames {
+		if _, ok := oldFields[name]; !ok {
+			names = append(names, name)
+		}
+	}
+
+	diffs := []FieldDiff{}
+	for _, name := range names {
+		oldValue := formatField(oldFields[name])
+		newValue := formatField(newFields[name])
+		if oldValue != newValue {
+			diffs = append(diffs, FieldDiff{Field: name, Current: oldValue, Desired: newValue})
+		}
+	}
+	return diffs
+}
+
+// exportedFields collects the exported fields of the value, keyed by their path (i.e. "Retry.Timeout"), along with the
+// paths in the order they were found. Fields of embedded structs are promoted, as in Go. Structs without exported
+// fields (i.e. time.Time), and pointers back to a struct that is already being collected, are treated as single values.
+// If skipMeta is set, the fields of embedded ResourceMetas are skipped.
+func exportedFields(v reflect.Value, skipMeta bool) (map[string]reflect.Value, []string) {
+	return collectFields(v, "", map[string]reflect.Value{}, nil, map[uintptr]bool{}, skipMeta)
+}
+
+func collectFields(v reflect.Value, prefix string, fields map[string]reflect.Value, names []string, visited map[uintptr]bool, skipMeta bool) (map[string]reflect.Value, []string) {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return fields, names
+		}
+		if v.Kind() == reflect.Ptr {
+			visited[v.Pointer()] = true
+			defer delete(visited, v.Pointer())
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return fields, names
+	}
+
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		if field.PkgPath != "" && !field.Anonymous {
+			continue
+		}
+		value := v.Field(i)
+		switch {
+		case value.Kind() == reflect.Func || value.Kind() == reflect.Chan:
+		case skipMeta && field.Anonymous && field.Type == reflect.TypeOf(ResourceMeta{}):
+		case revisits(value, visited):
+			// The struct's fields are already being collected, so are compared there
+			fields[prefix+field.Name] = reflect.ValueOf("<cycle>")
+			names = append(names, prefix+field.Name)
+		case field.Anonymous:
+			fields, names = collectFields(value, prefix, fields, names, visited, skipMeta)
+		case hasExportedFields(value):
+			fields, names = collectFields(value, prefix+field.Name+".", fields, names, visited, skipMeta)
+		default:
+			fields[prefix+field.Name] = value
+			names = append(names, prefix+field.Name)
+		}
+	}
+	return fields, names
+}
+
+// revisits returns true if the value is a pointer to a struct that is already being visited
+func revisits(v reflect.Value, visited map[uintptr]bool) bool {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return false
+		}
+		if v.Kind() == reflect.Ptr && visited[v.Pointer()] {
+			return true
+		}
+		v = v.Elem()
+	}
+	return false
+}
+
+// hasExportedFields returns true if the value is a struct with exported fields, or points to one
+func hasExportedFields(v reflect.Value) bool {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return false
+		}
+		v = v.Elem()
+	}
+	return v.Kind() == reflect.Struct && typeHasExportedFields(v.Type(), map[reflect.Type]bool{})
+}
+
+func typeHasExportedFields(t reflect.Type, seen map[reflect.Type]bool) bool {
+	if seen[t] {
+		return false
+	}
+	seen[t] = true
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath == "" {
+			return true
+		}
+		embedded := field.Type
+		for embedded.Kind() == reflect.Ptr {
+			embedded = embedded.Elem()
+		}
+		if field.Anonymous && embedded.Kind() == reflect.Struct && typeHasExportedFields(embedded, seen) {
+			return true
+		}
+	}
+	return false
+}
+
+// formatField formats the value for comparison. Pointers are followed, so that equal values built separately are
+// formatted identically, with "<cycle>" standing in for a pointer back to a value that is already being formatted.
+func formatField(v reflect.Value) string {
+	if !v.IsValid() {
+		return ""
+	}
+	return formatValue(v, map[uintptr]bool{})
+}
+
+func formatValue(v reflect.Value, visited map[uintptr]bool) string {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return "<nil>"
+		}
+		if v.Kind() == reflect.Ptr {
+			if visited[v.Pointer()] {
+				return "<cycle>"
+			}
+			visited[v.Pointer()] = true
+			defer delete(visited, v.Pointer())
+		}
+		return formatValue(v.Elem(), visited)
+	case reflect.Slice, reflect.Array:
+		elems := []string{}
+		for i := 0; i < v.Len(); i++ {
+			elems = append(elems, formatValue(v.Index(i), visited))
+		}
+		return "[" + strings.Join(elems, " ") + "]"
+	case reflect.Map:
+		if visited[v.Pointer()] {
+			return "<cycle>"
+		}
+		visited[v.Pointer()] = true
+		defer delete(visited, v.Pointer())
+		entries := []string{}
+		for _, key := range v.MapKeys() {
+			entries = append(entries, formatValue(key, visited)+":"+formatValue(v.MapIndex(key), visited))
+		}
+		sort.Strings(entries)
+		return "map[" + strings.Join(entries, " ") + "]"
+	case reflect.Struct:
+		if !hasExportedFields(v) {
+			break
+		}
+		fields := []string{}
+		for i := 0; i < v.NumField(); i++ {
+			if field := v.Type().Field(i); field.PkgPath == "" || field.Anonymous {
+				fields = append(fields, field.Name+":"+formatValue(v.Field(i), visited))
+			}
+		}
+		return "{" + strings.Join(fields, " ") + "}"
+	case reflect.Func, reflect.Chan:
+		return ""
+	}
+	// Formatting the reflect.Value directly allows fields promoted from unexported embedded structs to be printed
+	return fmt.Sprintf("%v", v)
+}
@@ -0,0 +1,105 @@
+package rfsb
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func mkDiffGraph(shell string, withSSHKey bool) *ResourceGraph {
+	users := &ResourceGraph{}
+	group := &GroupResource{Group: "lcm", GID: 1000}
+	users.Register("group", group)
+	user := &UserResource{User: "lcm", UID: 1000, GID: 1000, Home: "/home/lcm", Shell: shell}
+	users.When(group).Do("user", user)
+	if withSSHKey {
+		users.When(user, Materialized).Do("sshKey", &FileResource{Path: "/home/lcm/.ssh/authorized_keys", Mode: 0600})
+	}
+
+	rg := &ResourceGraph{}
+	rg.Register("users", users)
+	if !withSSHKey {
+		rg.When(users, Materialized).Do("reload", &CmdResource{Command: "true"})
+	}
+	return rg
+}
+
+func TestDiffGraphs(t *testing.T) {
+	t.Parallel()
+
+	before := mkDiffGraph("/bin/sh", false)
+	after := mkDiffGraph("/bin/bash", true)
+	diff := DiffGraphs(before, after)
+
+	assert.Equal(t, []string{"users·sshKey"}, diff.Added)
+	assert.Equal(t, []string{"reload"}, diff.Removed)
+	assert.Equal(t, []ResourceChange{{
+		Name:   "users·user",
+		Fields: []FieldDiff{{Field: "Shell", Current: "/bin/sh", Desired: "/bin/bash"}},
+	}}, diff.Changed)
+	assert.Equal(t, []EdgeChange{{From: "users·user", To: "users·sshKey", Signals: []Signal{Materialized}}}, diff.AddedEdges)
+	assert.Equal(t, []EdgeChange{{From: "users", To: "reload", Signals: []Signal{Materialized}}}, diff.RemovedEdges)
+
+	assert.Equal(t, `+ users·sshKey
+- reload
+~ users·user
+    Shell: "/bin/sh" -> "/bin/bash"
++ users·user -> users·sshKey (Materialized)
+- users -> reload (Materialized)
+`, diff.String())
+
+	encoded, err := json.Marshal(diff)
+	require.NoError(t, err)
+	decoded := &GraphDiff{}
+	require.NoError(t, json.Unmarshal(encoded, decoded))
+	assert.Equal(t, diff, decoded)
+
+	assert.True(t, DiffGraphs(before, mkDiffGraph("/bin/sh", false)).Empty())
+}
+
+func TestDiffFieldsFollowsEmbeddedResources(t *testing.T) {
+	t.Parallel()
+
+	before := &SkippingWrapper{Resource: &FileResource{Path: "/etc/motd", Mode: 0644}}
+	newFile := &FileResource{Path: "/etc/motd", Mode: 0600}
+	newFile.Tags = []string{"motd"}
+	after := &SkippingWrapper{Resource: newFile}
+	assert.Equal(t, []FieldDiff{
+		{Field: "Tags", Current: "[]", Desired: "[motd]"},
+		{Field: "Mode", Current: "-rw-r--r--", Desired: "-rw-------"},
+	}, diffFields(before, after))
+	assert.Equal(t, []FieldDiff{{Field: "type", Current: "*rfsb.SkippingWrapper", Desired: "*rfsb.FileResource"}},
+		diffFields(before, &FileResource{}))
+}
+
+// linkedResource has fields that point to other values, possibly cyclically
+type linkedResource struct {
+	ResourceMeta
+	Next    *linkedResource
+	Entries []*FieldDiff
+	Expires time.Time
+}
+
+func (lr *linkedResource) Materialize(context.Context) error {
+	return nil
+}
+
+func TestDiffFieldsFollowsPointers(t *testing.T) {
+	t.Parallel()
+
+	mk := func(current string, expires time.Time) *linkedResource {
+		lr := &linkedResource{Entries: []*FieldDiff{{Field: "a", Current: current}}, Expires: expires}
+		lr.Next = lr
+		return lr
+	}
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	assert.Empty(t, diffFields(mk("x", now), mk("x", now)))
+	assert.Equal(t, []FieldDiff{
+		{Field: "Entries", Current: "[{Field:a Current:x Desired:}]", Desired: "[{Field:a Current:y Desired:}]"},
+		{Field: "Expires", Current: now.String(), Desired: now.Add(time.Hour).String()},
+	}, diffFields(mk("x", now), mk("y", now.Add(time.Hour))))
+}
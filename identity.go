@@ -0,0 +1,287 @@
+package rfsb
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Identifiable should be implemented by resources that manage an object on the system that other resources could also
+// manage, such as a file or a user. Each key identifies one such object, e.g. "file:/etc/ssh/sshd_config".
+//
+// Validate checks that all resources sharing an identity key are configured identically. Only the fields describing
+// the managed object are compared, not those of the embedded ResourceMeta (such as Tags or Retry). Resources that are
+// not identical are reported as a *ConflictError, as whichever ran last would win.
+//
+// Once the graph is valid, Materialize and Plan merge identical resources into the first registered, which keeps its
+// own ResourceMeta, and then waits for the dependencies of all of them. Lookup still finds the merged resources by
+// their names, returning the resource they were merged into, and a Selector matching the name or Tags of a merged
+// resource selects the resource it was merged into.
+type Identifiable interface {
+	Resource
+	IdentityKeys() []string
+}
+
+// IdentityKeys identifies the file by its path
+func (fr *FileResource) IdentityKeys() []string {
+	return []string{"file:" + fr.Path}
+}
+
+// IdentityKeys identifies the user by both its UID and its name
+func (ur *UserResource) IdentityKeys() []string {
+	return []string{fmt.Sprintf("user:uid:%d", ur.UID), "user:name:" + ur.User}
+}
+
+// IdentityKeys identifies the group by both its GID and its name
+func (gr *GroupResource) IdentityKeys() []string {
+	return []string{fmt.Sprintf("group:gid:%d", gr.GID), "group:name:" + gr.Group}
+}
+
+// IdentityKeys identifies the membership by the group and the user. As the key covers all of the resource's
+// configuration, duplicates are always merged.
+func (gmr *GroupMembershipResource) IdentityKeys() []string {
+	return []string{fmt.Sprintf("group-membership:%d:%s", gmr.GID, gmr.User)}
+}
+
+// ConflictError describes two resources that manage the same object (identified by Key) in different ways
+type ConflictError struct {
+	Key       string
+	Resources []Resource
+	// Fields lists the differences between the two resources. Current holds the value of the first resource, and
+	// Desired the value of the second.
+	Fields []FieldDiff
+}
+
+func (ce *ConflictError) Error() string {
+	fields := []string{}
+	for _, field := range ce.Fields {
+		fields = append(fields, field.String())
+	}
+	return fmt.Sprintf("conflicting definitions of %s by %s and %s: %s",
+		ce.Key, describeResource(ce.Resources[0]), describeResource(ce.Resources[1]), strings.Join(fields, ", "))
+}
+
+// identities returns the identity keys of the graph's Identifiable resources, in the order they were first seen, along
+// with the resources sharing each key, in registration order
+func (rg *ResourceGraph) identities() ([]string, map[string][]Resource) {
+	keys := []string{}
+	byKey := map[string][]Resource{}
+	for _, r := range rg.resources {
+		identifiable, ok := r.(Identifiable)
+		if !ok {
+			continue
+		}
+		for _, key := range identifiable.IdentityKeys() {
+			if _, ok := byKey[key]; !ok {
+				keys = append(keys, key)
+			}
+			if !containsResource(byKey[key], r) {
+				byKey[key] = append(byKey[key], r)
+			}
+		}
+	}
+	return keys, byKey
+}
+
+// findConflicts returns a *ConflictError for each pair of resources that share an identity key but are configured
+// differently
+func (rg *ResourceGraph) findConflicts() []error {
+	keys, byKey := rg.identities()
+	errs := []error{}
+	reported := map[[2]Resource]bool{}
+	for _, key := range keys {
+		first := byKey[key][0]
+		for _, other := range byKey[key][1:] {
+			fields := diffState(first, other)
+			if len(fields) != 0 && !reported[[2]Resource{first, other}] {
+				reported[[2]Resource{first, other}] = true
+				errs = append(errs, &ConflictError{Key: key, Resources: []Resource{first, other}, Fields: fields})
+			}
+		}
+	}
+	return errs
+}
+
+// mergeIdenticalResources merges the resources sharing each identity key into the first registered of them. It must
+// only be called once findConflicts has found no conflicts, so that the resources sharing a key are identical.
+func (rg *ResourceGraph) mergeIdenticalResources() {
+	keys, byKey := rg.identities()
+	into := map[Resource]Resource{}
+	resolve := func(r Resource) Resource {
+		for {
+			replacement, ok := into[r]
+			if !ok {
+				return r
+			}
+			r = replacement
+		}
+	}
+	for _, key := range keys {
+		first := resolve(byKey[key][0])
+		for _, other := range byKey[key][1:] {
+			other = resolve(other)
+			if other == first {
+				continue
+			}
+			first.Logger().Infof("merging identical resource %v", other.Name())
+			rg.replaceResource(other, first)
+			into[other] = first
+		}
+	}
+}
+
+// validateAndMerge validates the graph, and then merges identical resources (see Identifiable). As merging resources
+// also merges their dependencies, the graph is checked for cycles again afterwards.
+func (rg *ResourceGraph) validateAndMerge() error {
+	if err := rg.Validate(); err != nil {
+		return err
+	}
+	rg.mergeIdenticalResources()
+	if errs := rg.findCycles(); len(errs) != 0 {
+		return &ValidationError{Errors: errs}
+	}
+	return nil
+}
+
+// replaceResource removes the resource from the graph, transferring its dependencies, dependents, requirements,
+// conditions and notifications to the replacement. Those between the resource and the replacement are dropped, as the
+// replacement can not wait for itself.
+func (rg *ResourceGraph) replaceResource(old, replacement Resource) {
+	rg.init()
+	rg.removeFromResources(old, replacement)
+	rg.merged[replacement] = append(append(rg.merged[replacement], old), rg.merged[old]...)
+	delete(rg.merged, old)
+
+	for to, signals := range rg.dependencies[old] {
+		inferred := rg.isInferred(old, to)
+		rg.removeEdge(old, to)
+		if to != replacement {
+			rg.transferEdge(replacement, to, signals, inferred)
+		}
+	}
+	for from, signals := range rg.inverseDependencies[old] {
+		inferred := rg.isInferred(from, old)
+		rg.removeEdge(from, old)
+		if from != replacement {
+			rg.transferEdge(from, replacement, signals, inferred)
+		}
+	}
+	delete(rg.dependencies, old)
+	delete(rg.inverseDependencies, old)
+
+	for _, clauses := range rg.requirements {
+		for _, cl := range clauses {
+			for _, alt := range cl {
+				for i := range alt {
+					if alt[i].resource == old {
+						alt[i].resource = replacement
+					}
+				}
+			}
+		}
+	}
+	rg.requirements[replacement] = withoutDependenciesOn(
+		append(rg.requirements[replacement], rg.requirements[old]...), replacement)
+	delete(rg.requirements, old)
+	rg.conditions[replacement] = append(rg.conditions[replacement], rg.conditions[old]...)
+	delete(rg.conditions, old)
+
+	for handler, notifiers := range rg.notifiers {
+		if _, ok := notifiers[old]; ok {
+			delete(notifiers, old)
+			if handler != replacement {
+				rg.addNotifier(replacement, handler)
+			}
+		}
+	}
+	for notifier := range rg.notifiers[old] {
+		if notifier != replacement {
+			rg.addNotifier(notifier, replacement)
+		}
+	}
+	delete(rg.notifiers, old)
+	if len(rg.notifiers[replacement]) == 0 {
+		delete(rg.notifiers, replacement)
+	}
+}
+
+// removeEdge removes the dependency between the two resources, dropping the maps that are left empty
+func (rg *ResourceGraph) removeEdge(from, to Resource) {
+	delete(rg.dependencies[from], to)
+	if len(rg.dependencies[from]) == 0 {
+		delete(rg.dependencies, from)
+	}
+	delete(rg.inverseDependencies[to], from)
+	if len(rg.inverseDependencies[to]) == 0 {
+		delete(rg.inverseDependencies, to)
+	}
+	delete(rg.inferred[to], from)
+	if len(rg.inferred[to]) == 0 {
+		delete(rg.inferred, to)
+	}
+}
+
+// transferEdge adds the signals of a removed dependency to the dependency between the two resources. The dependency is
+// only marked as inferred if it did not already exist, and the removed dependency was inferred.
+func (rg *ResourceGraph) transferEdge(from, to Resource, signals []Signal, inferred bool) {
+	_, existed := rg.dependencies[from][to]
+	for _, sig := range signals {
+		if !containsSignal(rg.dependencies[from][to], sig) {
+			rg.addEdge(from, sig, to)
+		}
+	}
+	if !existed && inferred {
+		if _, ok := rg.inferred[to]; !ok {
+			rg.inferred[to] = map[Resource]struct{}{}
+		}
+		rg.inferred[to][from] = struct{}{}
+	}
+}
+
+// withoutDependenciesOn returns the clauses with the dependencies on the resource removed
+func withoutDependenciesOn(clauses []clause, r Resource) []clause {
+	filtered := []clause{}
+	for _, cl := range clauses {
+		filteredClause := clause{}
+		for _, alt := range cl {
+			filteredAlt := alternative{}
+			for _, dep := range alt {
+				if dep.resource != r {
+					filteredAlt = append(filteredAlt, dep)
+				}
+			}
+			filteredClause = append(filteredClause, filteredAlt)
+		}
+		filtered = append(filtered, filteredClause)
+	}
+	return filtered
+}
+
+// removeFromResources removes the resource from the graph's resources, and from those of every nested graph. In nested
+// graphs, it is replaced by the replacement, so that the nested graph still waits for it.
+func (rg *ResourceGraph) removeFromResources(old, replacement Resource) {
+	resources := []Resource{}
+	for _, r := range rg.resources {
+		if r == old {
+			continue
+		}
+		if sub, ok := r.(*ResourceGraph); ok && containsResource(sub.resources, old) {
+			sub.resources = replaceInResources(sub.resources, old, replacement)
+		}
+		resources = append(resources, r)
+	}
+	rg.resources = resources
+}
+
+func replaceInResources(resources []Resource, old, replacement Resource) []Resource {
+	replaced := []Resource{}
+	for _, r := range resources {
+		if r == old {
+			if containsResource(resources, replacement) {
+				continue
+			}
+			r = replacement
+		}
+		replaced = append(replaced, r)
+	}
+	return replaced
+}
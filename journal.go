@@ -0,0 +1,168 @@
+package rfsb
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// Fingerprinter can be implemented by resources that cannot be fingerprinted by encoding them as JSON, or whose JSON
+// encoding does not capture their configuration. The fingerprint should change whenever the configuration does.
+type Fingerprinter interface {
+	Resource
+	Fingerprint() (string, error)
+}
+
+// fingerprint returns a hash of the resource's configuration. By default, this is a hash of its type and JSON encoding,
+// so only exported fields are taken into account.
+func fingerprint(r Resource) (string, error) {
+	if fingerprinter, ok := r.(Fingerprinter); ok {
+		return fingerprinter.Fingerprint()
+	}
+	encoded, err := json.Marshal(r)
+	if err != nil {
+		return "", errors.Wrapf(err, "could not fingerprint %v", r.Name())
+	}
+	sum := sha256.Sum256(append([]byte(fmt.Sprintf("%T:", r)), encoded...))
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// journalEntry records the outcome of a resource that completed successfully
+type journalEntry struct {
+	Name        string   `json:"name"`
+	Fingerprint string   `json:"fingerprint"`
+	Signal      Signal   `json:"signal"`
+	Signals     []Signal `json:"signals,omitempty"`
+}
+
+// journal is an append only log of the resources that have completed, used to resume an interrupted run
+type journal struct {
+	path    string
+	lock    sync.Mutex
+	file    *os.File
+	entries map[string]journalEntry
+}
+
+// openJournal reads the entries recorded by a previous run, if any, and opens the journal for appending. Entries that
+// cannot be decoded, such as a line that was only partially written when the previous run was killed, are ignored.
+func openJournal(path string) (*journal, error) {
+	j := &journal{path: path, entries: map[string]journalEntry{}}
+	existing, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, errors.Wrap(err, "could not read journal")
+	}
+	for _, line := range bytes.Split(existing, []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+		entry := journalEntry{}
+		if err := json.Unmarshal(line, &entry); err != nil {
+			logrus.Warnf("ignoring journal entry: %v", err)
+			continue
+		}
+		j.entries[entry.Name] = entry
+	}
+	if len(existing) != 0 {
+		logrus.Infof("resuming from journal with %d completed resources", len(j.entries))
+	}
+
+	j.file, err = os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not open journal")
+	}
+	// Terminate any partially written entry, so that it does not corrupt the next one
+	if len(existing) != 0 && existing[len(existing)-1] != '\n' {
+		if _, err := j.file.Write([]byte("\n")); err != nil {
+			j.file.Close()
+			return nil, errors.Wrap(err, "could not write journal")
+		}
+	}
+	return j, nil
+}
+
+// replay returns the entry recorded for the resource, if it completed in a previous run and its configuration has not
+// changed since
+func (j *journal) replay(r Resource) (journalEntry, bool) {
+	entry, ok := j.entries[r.Name()]
+	if !ok {
+		return journalEntry{}, false
+	}
+	fp, err := fingerprint(r)
+	if err != nil {
+		r.Logger().Warnf("not replaying journal entry: %v", err)
+		return journalEntry{}, false
+	}
+	if fp != entry.Fingerprint {
+		r.Logger().Infof("not replaying journal entry, as the resource has changed")
+		return journalEntry{}, false
+	}
+	return entry, true
+}
+
+// evaluatedDependency returns the first dependency, of those the resource received signals from, that was evaluated
+// in this run rather than replayed from the journal, or nil if there is none. A resource is not replayed if one of its
+// dependencies was evaluated again, as it may need to act on the dependency's changes, such as restarting a service
+// once its config has been rewritten.
+func (e *execution) evaluatedDependency(received map[Resource][]Signal) Resource {
+	for _, from := range e.graph.resources {
+		if _, ok := received[from]; ok && e.wasEvaluated(from) {
+			return from
+		}
+	}
+	return nil
+}
+
+// wasEvaluated returns true if the resource was evaluated in this run, rather than replayed or left unevaluated. A
+// nested graph was evaluated if any of its resources were. It must only be called once the resource has emitted a
+// signal, so that its record is no longer being written to.
+func (e *execution) wasEvaluated(r Resource) bool {
+	if sub, ok := r.(*ResourceGraph); ok {
+		for _, member := range sub.members() {
+			if e.wasEvaluated(member) {
+				return true
+			}
+		}
+		return false
+	}
+	record := e.records[r]
+	return record.Signal != Unevaluated && !record.Replayed
+}
+
+// record appends an entry for the resource to the journal, syncing it to disk
+func (j *journal) record(r Resource, sig Signal, signals []Signal) error {
+	fp, err := fingerprint(r)
+	if err != nil {
+		return err
+	}
+	line, err := json.Marshal(journalEntry{Name: r.Name(), Fingerprint: fp, Signal: sig, Signals: signals})
+	if err != nil {
+		return errors.Wrap(err, "could not encode journal entry")
+	}
+
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	if _, err := j.file.Write(append(line, '\n')); err != nil {
+		return errors.Wrap(err, "could not write journal entry")
+	}
+	return errors.Wrap(j.file.Sync(), "could not sync journal")
+}
+
+// finish closes the journal. If the run completed successfully, the journal is removed, so that the next run starts
+// from scratch.
+func (j *journal) finish(completed bool) error {
+	if err := j.file.Close(); err != nil {
+		return errors.Wrap(err, "could not close journal")
+	}
+	if !completed {
+		return nil
+	}
+	return errors.Wrap(os.Remove(j.path), "could not remove journal")
+}
@@ -0,0 +1,115 @@
+package rfsb
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJournalResumesInterruptedRun(t *testing.T) {
+	t.Parallel()
+
+	scratchDir, err := ioutil.TempDir("", t.Name())
+	require.NoError(t, err)
+	defer os.RemoveAll(scratchDir)
+	journalPath := filepath.Join(scratchDir, "journal")
+
+	first := &testResource{}
+	changed := &testResource{}
+	second := &testResource{err: errors.New("interrupted")}
+	rg := &ResourceGraph{Journal: journalPath}
+	rg.Register("first", first)
+	rg.Register("changed", changed)
+	rg.When(first, Materialized).And(changed).Do("second", second)
+
+	_, err = rg.MaterializeWithReport(context.Background())
+	require.Error(t, err)
+	_, err = os.Stat(journalPath)
+	require.NoError(t, err, "journal should be kept after a failed run")
+
+	second.err = nil
+	changed.Tags = []string{"reconfigured"}
+	report, err := rg.MaterializeWithReport(context.Background())
+	require.NoError(t, err)
+
+	assert.Equal(t, int32(1), first.materialized)
+	assert.True(t, report.Resources[0].Replayed)
+	assert.Equal(t, Materialized, report.Resources[0].Signal)
+	assert.Equal(t, int32(2), changed.materialized)
+	assert.False(t, report.Resources[1].Replayed)
+	assert.Equal(t, int32(2), second.materialized)
+	_, err = os.Stat(journalPath)
+	assert.True(t, os.IsNotExist(err), "journal should be removed after a successful run")
+}
+
+func TestJournalReevaluatesDependentsOfChangedResources(t *testing.T) {
+	t.Parallel()
+
+	scratchDir, err := ioutil.TempDir("", t.Name())
+	require.NoError(t, err)
+	defer os.RemoveAll(scratchDir)
+	journalPath := filepath.Join(scratchDir, "journal")
+
+	unchanged := &testResource{}
+	config := &testResource{}
+	configs := &ResourceGraph{}
+	configs.Register("config", config)
+	restart := &testResource{}
+	interrupted := &testResource{err: errors.New("interrupted")}
+	rg := &ResourceGraph{Journal: journalPath}
+	rg.Register("unchanged", unchanged)
+	rg.Register("configs", configs)
+	rg.When(configs, Materialized).Do("restart", restart)
+	rg.When(restart).And(unchanged).Do("interrupted", interrupted)
+
+	require.Error(t, rg.Materialize(context.Background()))
+
+	config.Tags = []string{"reconfigured"}
+	interrupted.err = nil
+	report, err := rg.MaterializeWithReport(context.Background())
+	require.NoError(t, err)
+
+	replayed := map[string]bool{}
+	for _, rr := range report.Resources {
+		replayed[rr.Name] = rr.Replayed
+	}
+	assert.True(t, replayed["unchanged"])
+	assert.Equal(t, int32(1), unchanged.materialized)
+	assert.False(t, replayed["configs·config"])
+	assert.Equal(t, int32(2), config.materialized)
+	assert.False(t, replayed["restart"])
+	assert.Equal(t, int32(2), restart.materialized)
+	assert.Equal(t, int32(2), interrupted.materialized)
+}
+
+func TestOpenJournalIgnoresPartialEntries(t *testing.T) {
+	t.Parallel()
+
+	scratchDir, err := ioutil.TempDir("", t.Name())
+	require.NoError(t, err)
+	defer os.RemoveAll(scratchDir)
+	journalPath := filepath.Join(scratchDir, "journal")
+	require.NoError(t, ioutil.WriteFile(journalPath, []byte(
+		`{"name":"done","fingerprint":"abc","signal":"Skipped"}`+"\n"+`{"name":"partial","finger`), 0600))
+
+	j, err := openJournal(journalPath)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]journalEntry{
+		"done": {Name: "done", Fingerprint: "abc", Signal: Skipped},
+	}, j.entries)
+
+	next := &testResource{}
+	next.SetName("next")
+	require.NoError(t, j.record(next, Materialized, nil))
+	require.NoError(t, j.finish(false))
+	j, err = openJournal(journalPath)
+	require.NoError(t, err)
+	defer j.finish(false)
+	assert.Contains(t, j.entries, "next")
+}
@@ -0,0 +1,77 @@
+package rfsb
+
+import (
+	"context"
+	"sort"
+)
+
+// Locker should be implemented by resources that modify state shared with other resources, such as a file that is
+// rewritten in place. ResourceGraph will never evaluate two resources that share a lock key concurrently, while still
+// running everything else in parallel.
+type Locker interface {
+	Resource
+	LockKeys() []string
+}
+
+// keyLocks holds a lock for every key returned by the Lockers in a ResourceGraph
+type keyLocks map[string]chan struct{}
+
+func newKeyLocks(resources []Resource) keyLocks {
+	locks := keyLocks{}
+	for _, r := range resources {
+		if locker, ok := r.(Locker); ok {
+			for _, key := range locker.LockKeys() {
+				if _, ok := locks[key]; !ok {
+					locks[key] = make(chan struct{}, 1)
+				}
+			}
+		}
+	}
+	return locks
+}
+
+// acquire takes all of the locks required by the resource, returning a function that will release them, and whether it
+// had to wait for any of them. Locks are always taken in the same order to avoid deadlocks.
+func (kl keyLocks) acquire(ctx context.Context, resource Resource) (func(), bool, error) {
+	locker, ok := resource.(Locker)
+	if !ok {
+		return func() {}, false, nil
+	}
+	return kl.acquireKeys(ctx, locker.LockKeys())
+}
+
+// acquireKeys takes the locks for all of the passed keys, returning a function that will release them, and whether it
+// had to wait for any of them
+func (kl keyLocks) acquireKeys(ctx context.Context, keys []string) (func(), bool, error) {
+	keys = append([]string{}, keys...)
+	sort.Strings(keys)
+
+	held := []chan struct{}{}
+	release := func() {
+		for i := len(held) - 1; i >= 0; i-- {
+			<-held[i]
+		}
+	}
+	waited := false
+	for i, key := range keys {
+		if i > 0 && keys[i-1] == key {
+			continue
+		}
+		lock := kl[key]
+		select {
+		case lock <- struct{}{}:
+			held = append(held, lock)
+			continue
+		default:
+			waited = true
+		}
+		select {
+		case lock <- struct{}{}:
+			held = append(held, lock)
+		case <-ctx.Done():
+			release()
+			return nil, waited, ctx.Err()
+		}
+	}
+	return release, waited, nil
+}
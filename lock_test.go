@@ -0,0 +1,61 @@
+package rfsb
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	_ Locker = &FileResource{}
+	_ Locker = &UserResource{}
+	_ Locker = &GroupResource{}
+	_ Locker = &GroupMembershipResource{}
+)
+
+// lockingResource records the maximum number of lockingResources sharing its counters that materialized at once
+type lockingResource struct {
+	ResourceMeta
+	keys       []string
+	running    *int32
+	maxRunning *int32
+}
+
+func (lr *lockingResource) LockKeys() []string {
+	return lr.keys
+}
+
+func (lr *lockingResource) Materialize(context.Context) error {
+	running := atomic.AddInt32(lr.running, 1)
+	defer atomic.AddInt32(lr.running, -1)
+	for {
+		max := atomic.LoadInt32(lr.maxRunning)
+		if running <= max || atomic.CompareAndSwapInt32(lr.maxRunning, max, running) {
+			break
+		}
+	}
+	time.Sleep(time.Millisecond)
+	return nil
+}
+
+func TestLockerSerializesSharedKeys(t *testing.T) {
+	t.Parallel()
+
+	var running, maxRunning int32
+	rg := &ResourceGraph{}
+	for i := 0; i < 10; i++ {
+		keys := []string{"/etc/group"}
+		if i%2 == 0 {
+			keys = []string{"/etc/passwd", "/etc/group"}
+		}
+		rg.Register(fmt.Sprintf("r%d", i), &lockingResource{keys: keys, running: &running, maxRunning: &maxRunning})
+	}
+
+	require.NoError(t, rg.Materialize(context.Background()))
+	assert.Equal(t, int32(1), maxRunning)
+}
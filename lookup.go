@@ -0,0 +1,72 @@
+package rfsb
+
+// Edge is a dependency between two registered resources. To waits for From to emit the Signals. Inferred is true if
+// the dependency was added by InferDependencies.
+type Edge struct {
+	From     Resource
+	To       Resource
+	Signals  []Signal
+	Inferred bool
+}
+
+// Lookup returns the registered Resource with the passed hierarchical name, i.e. "users·lcm" for the resource
+// registered as "lcm" in a ResourceGraph registered as "users". The second return value is false if there is no such
+// resource. Resources that were merged into an identical resource (see Identifiable) are found by their own name, and
+// the resource they were merged into is returned.
+func (rg *ResourceGraph) Lookup(name string) (Resource, bool) {
+	for _, r := range rg.resources {
+		if r.Name() == name {
+			return r, true
+		}
+	}
+	for _, r := range rg.resources {
+		for _, merged := range rg.merged[r] {
+			if merged.Name() == name {
+				return r, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// Resources returns every Resource registered with the graph, including those registered via nested ResourceGraphs,
+// in registration order
+func (rg *ResourceGraph) Resources() []Resource {
+	return append([]Resource{}, rg.resources...)
+}
+
+// Dependencies returns the edges from the resources the passed Resource depends on, in registration order
+func (rg *ResourceGraph) Dependencies(r Resource) []Edge {
+	index := rg.resourceIndex()
+	froms := []Resource{}
+	for from := range rg.inverseDependencies[r] {
+		if _, ok := index[from]; ok {
+			froms = append(froms, from)
+		}
+	}
+	sortByRegistration(index, froms)
+
+	edges := []Edge{}
+	for _, from := range froms {
+		edges = append(edges, rg.edge(from, r))
+	}
+	return edges
+}
+
+// Dependents returns the edges to the resources that depend on the passed Resource, in registration order
+func (rg *ResourceGraph) Dependents(r Resource) []Edge {
+	edges := []Edge{}
+	for _, to := range rg.sortedDependents(rg.resourceIndex(), r) {
+		edges = append(edges, rg.edge(r, to))
+	}
+	return edges
+}
+
+func (rg *ResourceGraph) edge(from, to Resource) Edge {
+	return Edge{
+		From:     from,
+		To:       to,
+		Signals:  append([]Signal{}, rg.dependencies[from][to]...),
+		Inferred: rg.isInferred(from, to),
+	}
+}
@@ -0,0 +1,44 @@
+package rfsb
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLookupAndEnumerate(t *testing.T) {
+	t.Parallel()
+
+	users := &ResourceGraph{}
+	lcm := &testResource{}
+	users.Register("lcm", lcm)
+
+	rg := &ResourceGraph{}
+	base := &testResource{}
+	rg.Register("base", base)
+	rg.When(base).Do("users", users)
+	after := &testResource{}
+	rg.When(users, Materialized).And(base, Finished).Do("after", after)
+
+	found, ok := rg.Lookup("users·lcm")
+	assert.True(t, ok)
+	assert.Equal(t, lcm, found)
+	found, ok = rg.Lookup("users")
+	assert.True(t, ok)
+	assert.Equal(t, users, found)
+	_, ok = rg.Lookup("lcm")
+	assert.False(t, ok)
+
+	assert.Equal(t, []Resource{base, lcm, users, after}, rg.Resources())
+
+	assert.Equal(t, []Edge{
+		{From: base, To: lcm, Signals: []Signal{Evaluated}},
+		{From: base, To: after, Signals: []Signal{Finished}},
+	}, rg.Dependents(base))
+	assert.Equal(t, []Edge{
+		{From: base, To: after, Signals: []Signal{Finished}},
+		{From: users, To: after, Signals: []Signal{Materialized}},
+	}, rg.Dependencies(after))
+	assert.Empty(t, rg.Dependencies(base))
+	assert.Equal(t, []Edge{{From: lcm, To: users, Signals: []Signal{Finished}}}, rg.Dependencies(users))
+}
@@ -0,0 +1,65 @@
+package rfsb
+
+// Notify registers the handler to be notified when the notifier is materialized. However many resources notify a
+// handler, it will be evaluated at most once per Materialize. It is evaluated after all of its notifiers have
+// finished, and only if at least one of them emitted the Materialized signal. Otherwise, it is Unevaluated.
+//
+// For example, to restart nginx once, no matter how many of its config files change:
+//
+//    restart := &rfsb.CmdResource{Command: "/usr/bin/systemctl", Arguments: []string{"restart", "nginx"}}
+//    rg.Register("restartNginx", restart)
+//    for _, conf := range nginxConfigs {
+//        rg.Register(conf.Name(), conf)
+//        rg.Notify(conf, restart)
+//    }
+//
+// If the notifier is a ResourceGraph, every resource in the graph will notify the handler. The handler must be
+// registered separately, but may also have regular dependencies.
+func (rg *ResourceGraph) Notify(notifier Resource, handler Resource) {
+	rg.init()
+	notifiers := []Resource{notifier}
+	if notifierRG, ok := notifier.(*ResourceGraph); ok {
+		notifiers = notifierRG.members()
+	}
+	handlers := []Resource{handler}
+	if handlerRG, ok := handler.(*ResourceGraph); ok {
+		handlers = handlerRG.rootResources()
+	}
+
+	for _, notifier := range notifiers {
+		for _, handler := range handlers {
+			rg.addNotifier(notifier, handler)
+			rg.RegisterDependency(notifier, Finished, handler)
+		}
+	}
+}
+
+func (rg *ResourceGraph) addNotifier(notifier Resource, handler Resource) {
+	if _, ok := rg.notifiers[handler]; !ok {
+		rg.notifiers[handler] = map[Resource]struct{}{}
+	}
+	rg.notifiers[handler][notifier] = struct{}{}
+}
+
+func (rg *ResourceGraph) isNotifier(notifier Resource, handler Resource) bool {
+	_, ok := rg.notifiers[handler][notifier]
+	return ok
+}
+
+func containsSignal(signals []Signal, wanted Signal) bool {
+	for _, sig := range signals {
+		if sig == wanted {
+			return true
+		}
+	}
+	return false
+}
+
+func containsResource(resources []Resource, wanted Resource) bool {
+	for _, r := range resources {
+		if r == wanted {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,105 @@
+package rfsb
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNotify(t *testing.T) {
+	t.Parallel()
+
+	rg := &ResourceGraph{}
+	handler := &testResource{}
+	rg.Register("handler", handler)
+	for i := 0; i < 10; i++ {
+		file := &testResource{skip: i%3 != 0}
+		rg.Register(fmt.Sprintf("file%d", i), file)
+		rg.Notify(file, handler)
+	}
+	quietHandler := &testResource{}
+	rg.Register("quietHandler", quietHandler)
+	for i := 0; i < 3; i++ {
+		file := &testResource{skip: true}
+		rg.Register(fmt.Sprintf("unchanged%d", i), file)
+		rg.Notify(file, quietHandler)
+	}
+
+	report, err := rg.MaterializeWithReport(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), handler.materialized)
+	assert.Equal(t, int32(0), quietHandler.materialized)
+	assert.Equal(t, Unevaluated, report.Resources[11].Signal)
+	assert.Equal(t, []string{"unchanged0", "unchanged1", "unchanged2"}, report.Resources[11].BlockedBy)
+}
+
+// gatedResource blocks in Materialize until its gate is closed
+type gatedResource struct {
+	ResourceMeta
+	gate chan struct{}
+}
+
+func (gr *gatedResource) Materialize(context.Context) error {
+	<-gr.gate
+	return nil
+}
+
+// closingResource closes done once it has been materialized
+type closingResource struct {
+	testResource
+	done chan struct{}
+}
+
+func (cr *closingResource) Materialize(ctx context.Context) error {
+	defer close(cr.done)
+	return cr.testResource.Materialize(ctx)
+}
+
+func TestNotifyWaitsForAllNotifiers(t *testing.T) {
+	t.Parallel()
+
+	rg := &ResourceGraph{}
+	handler := &testResource{}
+	rg.Register("handler", handler)
+	fast := &closingResource{done: make(chan struct{})}
+	rg.Register("fast", fast)
+	rg.Notify(fast, handler)
+	slow := &gatedResource{gate: make(chan struct{})}
+	rg.Register("slow", slow)
+	rg.Notify(slow, handler)
+
+	done := make(chan error)
+	go func() {
+		done <- rg.Materialize(context.Background())
+	}()
+	<-fast.done
+	assert.Equal(t, int32(1), atomic.LoadInt32(&fast.materialized))
+	assert.Equal(t, int32(0), atomic.LoadInt32(&handler.materialized))
+
+	close(slow.gate)
+	require.NoError(t, <-done)
+	assert.Equal(t, int32(1), handler.materialized)
+}
+
+func TestNotifyPlan(t *testing.T) {
+	t.Parallel()
+
+	rg := &ResourceGraph{}
+	handler := &testResource{}
+	rg.Register("handler", handler)
+	changes := &testResource{}
+	rg.Register("changes", changes)
+	rg.Notify(changes, handler)
+	unchanged := &testResource{skip: true}
+	rg.Register("unchanged", unchanged)
+	rg.Notify(unchanged, handler)
+
+	plan, err := rg.Plan(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, PlanMaterialize, plan.Entries[0].Action)
+	assert.Equal(t, []Resource{changes}, plan.Entries[0].TriggeredBy)
+}
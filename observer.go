@@ -0,0 +1,98 @@
+package rfsb
+
+import "context"
+
+// Observer receives callbacks as a ResourceGraph is materialized, allowing progress UIs, metrics and audit logs to be
+// built without wrapping every Resource. Callbacks are made from the goroutines evaluating each Resource, so
+// implementations must be safe for concurrent use, and should return quickly.
+//
+// Observers can be added to the ResourceGraph via its Observers field, or to a single run via WithObserver.
+type Observer interface {
+	// EvaluationStarted is called when a Resource's dependencies have been met, and it is about to be evaluated
+	EvaluationStarted(Resource)
+	// ShouldSkipFinished is called with the result of a SkippableResource's ShouldSkip method
+	ShouldSkipFinished(r Resource, shouldSkip bool, err error)
+	// MaterializeStarted is called before a Resource's Materialize method is called
+	MaterializeStarted(Resource)
+	// MaterializeFinished is called with the result of a Resource's Materialize method
+	MaterializeFinished(Resource, error)
+	// ResourceFailed is called when a Resource fails, after any retries have been exhausted
+	ResourceFailed(Resource, error)
+	// SignalEmitted is called for each signal emitted for a Resource, before it is sent to the Resource's dependents
+	SignalEmitted(Resource, Signal)
+}
+
+// NopObserver implements Observer, doing nothing for each callback. It can be embedded by implementations that are
+// only interested in some callbacks.
+type NopObserver struct{}
+
+// EvaluationStarted does nothing
+func (NopObserver) EvaluationStarted(Resource) {}
+
+// ShouldSkipFinished does nothing
+func (NopObserver) ShouldSkipFinished(Resource, bool, error) {}
+
+// MaterializeStarted does nothing
+func (NopObserver) MaterializeStarted(Resource) {}
+
+// MaterializeFinished does nothing
+func (NopObserver) MaterializeFinished(Resource, error) {}
+
+// ResourceFailed does nothing
+func (NopObserver) ResourceFailed(Resource, error) {}
+
+// SignalEmitted does nothing
+func (NopObserver) SignalEmitted(Resource, Signal) {}
+
+type observerKey struct{}
+
+// WithObserver returns a context that will cause the passed Observer to be notified of events when the context is
+// passed to Materialize
+func WithObserver(ctx context.Context, observer Observer) context.Context {
+	observers := append(observersFrom(ctx), observer)
+	return context.WithValue(ctx, observerKey{}, observers)
+}
+
+func observersFrom(ctx context.Context) multiObserver {
+	observers, _ := ctx.Value(observerKey{}).(multiObserver)
+	return append(multiObserver{}, observers...)
+}
+
+// multiObserver passes each callback on to all of its Observers
+type multiObserver []Observer
+
+func (mo multiObserver) EvaluationStarted(r Resource) {
+	for _, o := range mo {
+		o.EvaluationStarted(r)
+	}
+}
+
+func (mo multiObserver) ShouldSkipFinished(r Resource, shouldSkip bool, err error) {
+	for _, o := range mo {
+		o.ShouldSkipFinished(r, shouldSkip, err)
+	}
+}
+
+func (mo multiObserver) MaterializeStarted(r Resource) {
+	for _, o := range mo {
+		o.MaterializeStarted(r)
+	}
+}
+
+func (mo multiObserver) MaterializeFinished(r Resource, err error) {
+	for _, o := range mo {
+		o.MaterializeFinished(r, err)
+	}
+}
+
+func (mo multiObserver) ResourceFailed(r Resource, err error) {
+	for _, o := range mo {
+		o.ResourceFailed(r, err)
+	}
+}
+
+func (mo multiObserver) SignalEmitted(r Resource, sig Signal) {
+	for _, o := range mo {
+		o.SignalEmitted(r, sig)
+	}
+}
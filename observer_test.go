@@ -0,0 +1,84 @@
+package rfsb
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var _ Observer = NopObserver{}
+
+// recordingObserver records every callback as a string
+type recordingObserver struct {
+	lock   sync.Mutex
+	events []string
+}
+
+func (ro *recordingObserver) record(format string, args ...interface{}) {
+	ro.lock.Lock()
+	defer ro.lock.Unlock()
+	ro.events = append(ro.events, fmt.Sprintf(format, args...))
+}
+
+func (ro *recordingObserver) EvaluationStarted(r Resource) {
+	ro.record("%s: evaluating", r.Name())
+}
+
+func (ro *recordingObserver) ShouldSkipFinished(r Resource, shouldSkip bool, err error) {
+	ro.record("%s: should skip %v (%v)", r.Name(), shouldSkip, err)
+}
+
+func (ro *recordingObserver) MaterializeStarted(r Resource) {
+	ro.record("%s: materializing", r.Name())
+}
+
+func (ro *recordingObserver) MaterializeFinished(r Resource, err error) {
+	ro.record("%s: materialized (%v)", r.Name(), err)
+}
+
+func (ro *recordingObserver) ResourceFailed(r Resource, err error) {
+	ro.record("%s: failed (%v)", r.Name(), err)
+}
+
+func (ro *recordingObserver) SignalEmitted(r Resource, sig Signal) {
+	ro.record("%s: emitted %v", r.Name(), sig)
+}
+
+func TestObserver(t *testing.T) {
+	t.Parallel()
+
+	graphObserver := &recordingObserver{}
+	contextObserver := &recordingObserver{}
+	rg := &ResourceGraph{Observers: []Observer{graphObserver}}
+	first := &testResource{}
+	second := &testResource{err: errors.New("oh no")}
+	rg.Register("first", first)
+	rg.When(first).Do("second", second)
+
+	ctx := WithObserver(context.Background(), contextObserver)
+	require.Error(t, rg.Materialize(ctx))
+
+	expected := []string{
+		"first: evaluating",
+		"first: should skip false (<nil>)",
+		"first: materializing",
+		"first: materialized (<nil>)",
+		"first: emitted Materialized",
+		"first: emitted Evaluated",
+		"first: emitted Finished",
+		"second: evaluating",
+		"second: should skip false (<nil>)",
+		"second: materializing",
+		"second: materialized (oh no)",
+		"second: failed (could not materialize resource second: oh no)",
+		"second: emitted Failed",
+		"second: emitted Finished",
+	}
+	assert.Equal(t, expected, graphObserver.events)
+	assert.Equal(t, expected, contextObserver.events)
+}
@@ -0,0 +1,193 @@
+package rfsb
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// PlanAction describes what Materialize would do with a Resource
+type PlanAction byte
+
+const (
+	// PlanMaterialize means the Resource would be materialized. Either its ShouldSkip method returned false, or it
+	// is not a SkippableResource.
+	PlanMaterialize PlanAction = iota
+	// PlanSkip means the Resource's ShouldSkip method returned true
+	PlanSkip
+	// PlanUnevaluated means the Resource's dependencies would finish without emitting the signals it depends on
+	PlanUnevaluated
+	// PlanNotSelected means the Resource is excluded by the ResourceGraph's Selector
+	PlanNotSelected
+)
+
+func (pa PlanAction) String() string {
+	switch pa {
+	case PlanMaterialize:
+		return "Materialize"
+	case PlanSkip:
+		return "Skip"
+	case PlanUnevaluated:
+		return "Unevaluated"
+	case PlanNotSelected:
+		return "NotSelected"
+	default:
+		return "UNKNOWN_ACTION"
+	}
+}
+
+// PlanEntry describes what would happen to a single Resource
+type PlanEntry struct {
+	Resource Resource
+	Action   PlanAction
+	// TriggeredBy lists the dependencies (and notifiers) whose Materialized signal the Resource waits for, and that are
+	// planned to be materialized. The Resource would only run if these dependencies actually change.
+	TriggeredBy []Resource
+	// BlockedBy lists the dependencies that would finish without emitting the signals the Resource waits for. It is
+	// empty if the Resource would be Unevaluated because a condition added via DependencySetter.If was not met.
+	BlockedBy []Resource
+	// Diff describes the changes that would be made, if the Resource would be materialized and implements Differ
+	Diff *Diff
+	// Err is set if ShouldSkip failed. In this case, the Resource is assumed to require materialization.
+	Err error
+}
+
+func (pe PlanEntry) String() string {
+	switch {
+	case pe.Action == PlanNotSelected:
+		return fmt.Sprintf("  %s (not selected)", pe.Resource.Name())
+	case pe.Action == PlanUnevaluated && len(pe.BlockedBy) == 0:
+		return fmt.Sprintf("- %s (would not be evaluated: condition not met)", pe.Resource.Name())
+	case pe.Action == PlanUnevaluated:
+		return fmt.Sprintf("- %s (would not be evaluated: blocked by %s)", pe.Resource.Name(), joinNames(pe.BlockedBy))
+	case pe.Action == PlanSkip:
+		return fmt.Sprintf("= %s (would skip)", pe.Resource.Name())
+	case pe.Err != nil:
+		return fmt.Sprintf("~ %s (would change: could not check for changes: %v)", pe.Resource.Name(), pe.Err)
+	case len(pe.TriggeredBy) != 0:
+		return fmt.Sprintf("~ %s (would run if %s changes)", pe.Resource.Name(), joinNames(pe.TriggeredBy))
+	default:
+		return fmt.Sprintf("~ %s (would change)", pe.Resource.Name())
+	}
+}
+
+// Plan is the result of a dry run of a ResourceGraph. Entries are listed in registration order. Nested ResourceGraphs
+// do not have entries of their own.
+type Plan struct {
+	Entries []PlanEntry
+}
+
+func (p *Plan) String() string {
+	buf := &bytes.Buffer{}
+	for _, entry := range p.Entries {
+		buf.WriteString(entry.String())
+		buf.WriteByte('\n')
+		if entry.Diff == nil || entry.Diff.Empty() {
+			continue
+		}
+		for _, line := range strings.Split(strings.TrimSuffix(entry.Diff.String(), "\n"), "\n") {
+			buf.WriteString("    ")
+			buf.WriteString(line)
+			buf.WriteByte('\n')
+		}
+	}
+	return buf.String()
+}
+
+// plannedToMaterialize returns true if the resource is planned to be materialized. A ResourceGraph is planned to be
+// materialized if any of its resources are.
+func plannedToMaterialize(entries map[Resource]*PlanEntry, r Resource) bool {
+	if rg, ok := r.(*ResourceGraph); ok {
+		for _, member := range rg.members() {
+			if plannedToMaterialize(entries, member) {
+				return true
+			}
+		}
+		return false
+	}
+	entry, ok := entries[r]
+	return ok && entry.Action == PlanMaterialize
+}
+
+func joinNames(resources []Resource) string {
+	names := []string{}
+	for _, r := range resources {
+		names = append(names, r.Name())
+	}
+	return strings.Join(names, ", ")
+}
+
+// Plan performs a dry run of the ResourceGraph. Every SkippableResource whose dependencies would be met has its
+// ShouldSkip method called, but no Resource is materialized. Resources that would be materialized are assumed to emit
+// the Materialized signal, so that resources depending on that signal are included in the plan, noting which changes
+// they would be triggered by.
+//
+// As nothing is materialized, ShouldSkip may see the state from before its dependencies would have run. Errors from
+// ShouldSkip are recorded in the plan rather than failing it. Conditions added via DependencySetter.If are checked for
+// real, as they decide which resources would be evaluated.
+func (rg *ResourceGraph) Plan(ctx context.Context) (*Plan, error) {
+	if err := rg.validateAndMerge(); err != nil {
+		return nil, err
+	}
+
+	lock := sync.Mutex{}
+	entries := make(map[Resource]*PlanEntry, len(rg.resources))
+	exec := &execution{graph: rg}
+	exec.evaluate = func(ctx context.Context, resource Resource) (Signal, error) {
+		entry := &PlanEntry{Resource: resource, Action: PlanMaterialize}
+		if skippable, ok := resource.(SkippableResource); ok {
+			shouldSkip, err := skippable.ShouldSkip(ctx)
+			exec.observers.ShouldSkipFinished(resource, shouldSkip, err)
+			if err != nil {
+				resource.Logger().Warnf("could not determine if materialization should be skipped: %v", err)
+				entry.Err = err
+			} else if shouldSkip {
+				entry.Action = PlanSkip
+			}
+		}
+		if entry.Action == PlanMaterialize {
+			entry.Diff = diffResource(ctx, resource)
+		}
+
+		lock.Lock()
+		defer lock.Unlock()
+		for from, signals := range rg.inverseDependencies[resource] {
+			if !plannedToMaterialize(entries, from) {
+				continue
+			}
+			if containsSignal(signals, Materialized) || rg.isNotifier(from, resource) {
+				entry.TriggeredBy = append(entry.TriggeredBy, from)
+			}
+		}
+		entries[resource] = entry
+
+		if entry.Action == PlanSkip {
+			resource.Logger().Infof("would skip resource materialization")
+			return Skipped, nil
+		}
+		resource.Logger().Infof("would materialize resource")
+		return Materialized, nil
+	}
+	exec.unevaluated = func(resource Resource, unmet []Resource) {
+		lock.Lock()
+		defer lock.Unlock()
+		entries[resource] = &PlanEntry{Resource: resource, Action: PlanUnevaluated, BlockedBy: unmet}
+	}
+	if err := exec.run(ctx); err != nil {
+		return nil, err
+	}
+
+	index := rg.resourceIndex()
+	plan := &Plan{}
+	for _, r := range rg.members() {
+		entry, ok := entries[r]
+		if !ok {
+			entry = &PlanEntry{Resource: r, Action: PlanNotSelected}
+		}
+		sortByRegistration(index, entry.TriggeredBy)
+		plan.Entries = append(plan.Entries, *entry)
+	}
+	return plan, nil
+}
@@ -0,0 +1,50 @@
+package rfsb
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlan(t *testing.T) {
+	t.Parallel()
+
+	rg := &ResourceGraph{}
+	changed := &testResource{}
+	skipped := &testResource{skip: true}
+	afterChanged := &testResource{}
+	afterSkipped := &testResource{}
+	afterAfterSkipped := &testResource{}
+	rg.Register("changed", changed)
+	rg.Register("skipped", skipped)
+	rg.When(changed, Materialized).Do("afterChanged", afterChanged)
+	rg.When(skipped, Materialized).Do("afterSkipped", afterSkipped)
+	rg.When(afterSkipped).Do("afterAfterSkipped", afterAfterSkipped)
+
+	plan, err := rg.Plan(context.Background())
+	require.NoError(t, err)
+	require.Len(t, plan.Entries, 5)
+
+	assert.Equal(t, PlanMaterialize, plan.Entries[0].Action)
+	assert.Empty(t, plan.Entries[0].TriggeredBy)
+	assert.Equal(t, PlanSkip, plan.Entries[1].Action)
+	assert.Equal(t, PlanMaterialize, plan.Entries[2].Action)
+	assert.Equal(t, []Resource{changed}, plan.Entries[2].TriggeredBy)
+	assert.Equal(t, PlanUnevaluated, plan.Entries[3].Action)
+	assert.Equal(t, []Resource{skipped}, plan.Entries[3].BlockedBy)
+	assert.Equal(t, PlanUnevaluated, plan.Entries[4].Action)
+	assert.Equal(t, []Resource{afterSkipped}, plan.Entries[4].BlockedBy)
+
+	for _, r := range []*testResource{changed, skipped, afterChanged, afterSkipped, afterAfterSkipped} {
+		assert.Equal(t, int32(0), r.materialized)
+	}
+
+	assert.Equal(t, `~ changed (would change)
+= skipped (would skip)
+~ afterChanged (would run if changed changes)
+- afterSkipped (would not be evaluated: blocked by skipped)
+- afterAfterSkipped (would not be evaluated: blocked by afterSkipped)
+`, plan.String())
+}
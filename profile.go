@@ -0,0 +1,186 @@
+package rfsb
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"time"
+)
+
+// Span is a period of time
+type Span struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// acquire takes the resource's scheduler slot and then its locks, recording any time spent waiting for them as queued.
+// Once both are held, the resource is recorded as started, if it has not already.
+func (e *execution) acquire(ctx context.Context, resource Resource) (free func(), release func(), err error) {
+	start := time.Now()
+	free, slotWaited, err := e.slots.acquire(ctx, resource)
+	if err != nil {
+		e.queued(resource, start)
+		return nil, nil, err
+	}
+	release, lockWaited, err := e.locks.acquire(ctx, resource)
+	if slotWaited || lockWaited || err != nil {
+		e.queued(resource, start)
+	}
+	if err != nil {
+		free()
+		return nil, nil, err
+	}
+	if record := e.records[resource]; record.Started.IsZero() {
+		record.Started = time.Now()
+	}
+	return free, release, nil
+}
+
+// queued records that the resource has been waiting, rather than working, since the passed time
+func (e *execution) queued(resource Resource, since time.Time) {
+	record := e.records[resource]
+	record.Queued = append(record.Queued, Span{Start: since, End: time.Now()})
+}
+
+// end returns the time the resource finished. Resources that were not evaluated finish as soon as their dependencies
+// are resolved.
+func (rr *RunReport) end(resource ResourceReport) time.Time {
+	if !resource.Finished.IsZero() {
+		return resource.Finished
+	}
+	return rr.Started.Add(resource.Wait)
+}
+
+// CriticalPath returns the chain of resources that determined how long the run took. It ends with the Resource that
+// finished last, and each preceding Resource is the dependency that the next was waiting on (see
+// ResourceReport.ReleasedBy). Speeding up resources that are not on the critical path will not speed up the run.
+func (rr *RunReport) CriticalPath() []ResourceReport {
+	if len(rr.Resources) == 0 {
+		return nil
+	}
+	byName := make(map[string]ResourceReport, len(rr.Resources))
+	last := rr.Resources[0]
+	for _, resource := range rr.Resources {
+		byName[resource.Name] = resource
+		if rr.end(resource).After(rr.end(last)) {
+			last = resource
+		}
+	}
+
+	path := []ResourceReport{last}
+	for {
+		previous, ok := byName[path[0].ReleasedBy]
+		if !ok {
+			return path
+		}
+		path = append([]ResourceReport{previous}, path...)
+	}
+}
+
+// traceEvent is an event in the Chrome trace event format
+type traceEvent struct {
+	Name      string                 `json:"name"`
+	Category  string                 `json:"cat,omitempty"`
+	Phase     string                 `json:"ph"`
+	Timestamp int64                  `json:"ts"`
+	Duration  int64                  `json:"dur,omitempty"`
+	PID       int                    `json:"pid"`
+	TID       int                    `json:"tid"`
+	Args      map[string]interface{} `json:"args,omitempty"`
+}
+
+// working returns the periods between the Resource starting and finishing that it was not queued
+func (rr *ResourceReport) working() []Span {
+	spans := []Span{}
+	start := rr.Started
+	for _, span := range rr.Queued {
+		if span.Start.Before(rr.Started) {
+			continue
+		}
+		if span.Start.After(start) {
+			spans = append(spans, Span{Start: start, End: span.Start})
+		}
+		if span.End.After(start) {
+			start = span.End
+		}
+	}
+	if rr.Finished.After(start) {
+		spans = append(spans, Span{Start: start, End: rr.Finished})
+	}
+	return spans
+}
+
+// WriteTrace writes the timings of the run to the writer in the Chrome trace event format, which can be opened in
+// chrome://tracing or Perfetto. Each Resource is shown on its own row, with a "wait" span covering the time it was
+// blocked on its dependencies, "queued" spans covering the time it then spent waiting for its turn in Serial mode, a
+// scheduler slot, lock keys, the rest of its batch or a retry, and "work" spans covering its evaluation. Resources on the critical path are
+// marked with the "critical" argument.
+func (rr *RunReport) WriteTrace(w io.Writer) error {
+	critical := map[string]bool{}
+	for _, resource := range rr.CriticalPath() {
+		critical[resource.Name] = true
+	}
+	micros := func(t time.Time) int64 {
+		return int64(t.Sub(rr.Started) / time.Microsecond)
+	}
+
+	events := []traceEvent{}
+	for i, resource := range rr.Resources {
+		if resource.NotSelected {
+			continue
+		}
+		tid := i + 1
+		args := map[string]interface{}{"signal": resource.Signal, "critical": critical[resource.Name]}
+		if resource.ReleasedBy != "" {
+			args["released_by"] = resource.ReleasedBy
+		}
+		events = append(events, traceEvent{
+			Name:  "thread_name",
+			Phase: "M",
+			PID:   1,
+			TID:   tid,
+			Args:  map[string]interface{}{"name": resource.Name},
+		})
+		events = append(events, traceEvent{
+			Name:     resource.Name,
+			Category: "wait",
+			Phase:    "X",
+			Duration: int64(resource.Wait / time.Microsecond),
+			PID:      1,
+			TID:      tid,
+			Args:     args,
+		})
+		for _, span := range resource.Queued {
+			events = append(events, traceEvent{
+				Name:      resource.Name,
+				Category:  "queued",
+				Phase:     "X",
+				Timestamp: micros(span.Start),
+				Duration:  int64(span.End.Sub(span.Start) / time.Microsecond),
+				PID:       1,
+				TID:       tid,
+				Args:      args,
+			})
+		}
+		if resource.Started.IsZero() {
+			continue
+		}
+		for _, span := range resource.working() {
+			events = append(events, traceEvent{
+				Name:      resource.Name,
+				Category:  "work",
+				Phase:     "X",
+				Timestamp: micros(span.Start),
+				Duration:  int64(span.End.Sub(span.Start) / time.Microsecond),
+				PID:       1,
+				TID:       tid,
+				Args:      args,
+			})
+		}
+	}
+
+	return json.NewEncoder(w).Encode(struct {
+		TraceEvents     []traceEvent `json:"traceEvents"`
+		DisplayTimeUnit string       `json:"displayTimeUnit"`
+	}{events, "ms"})
+}
@@ -0,0 +1,117 @@
+package rfsb
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// sleepingResource takes the given duration to materialize
+type sleepingResource struct {
+	ResourceMeta
+	duration time.Duration
+}
+
+func (sr *sleepingResource) Materialize(context.Context) error {
+	time.Sleep(sr.duration)
+	return nil
+}
+
+func TestCriticalPathAndTrace(t *testing.T) {
+	t.Parallel()
+
+	rg := &ResourceGraph{}
+	first := &testResource{}
+	rg.Register("first", first)
+	slow := &sleepingResource{duration: 30 * time.Millisecond}
+	rg.When(first).Do("slow", slow)
+	fast := &sleepingResource{duration: time.Millisecond}
+	rg.When(first).Do("fast", fast)
+	last := &testResource{}
+	rg.When(slow).And(fast).Do("last", last)
+	rg.Register("unrelated", &sleepingResource{duration: 5 * time.Millisecond})
+
+	report, err := rg.MaterializeWithReport(context.Background())
+	require.NoError(t, err)
+
+	names := []string{}
+	for _, resource := range report.CriticalPath() {
+		names = append(names, resource.Name)
+	}
+	assert.Equal(t, []string{"first", "slow", "last"}, names)
+	assert.True(t, report.Resources[3].Wait >= 30*time.Millisecond)
+	assert.True(t, report.Resources[1].Duration() >= 30*time.Millisecond)
+
+	buf := &bytes.Buffer{}
+	require.NoError(t, report.WriteTrace(buf))
+	trace := struct {
+		TraceEvents []traceEvent `json:"traceEvents"`
+	}{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &trace))
+	critical := map[string]bool{}
+	work := 0
+	for _, event := range trace.TraceEvents {
+		if event.Category == "work" {
+			work++
+			critical[event.Name] = event.Args["critical"].(bool)
+		}
+	}
+	assert.Equal(t, 5, work)
+	assert.Equal(t, map[string]bool{"first": true, "slow": true, "fast": false, "last": true, "unrelated": false}, critical)
+}
+
+func TestSerialTurnIsQueued(t *testing.T) {
+	t.Parallel()
+
+	rg := &ResourceGraph{Serial: true}
+	rg.Register("a", &sleepingResource{duration: 30 * time.Millisecond})
+	rg.Register("b", &sleepingResource{duration: 30 * time.Millisecond})
+
+	report, err := rg.MaterializeWithReport(context.Background())
+	require.NoError(t, err)
+	first, second := report.Resources[0], report.Resources[1]
+	if second.Started.Before(first.Started) {
+		first, second = second, first
+	}
+	// Neither resource has dependencies, so waiting for the other to finish is queueing, not blocking
+	assert.True(t, second.Wait < first.Finished.Sub(report.Started), "wait %v includes the turn of %v", second.Wait, first.Name)
+	require.Len(t, second.Queued, 1)
+	assert.False(t, second.Queued[0].End.After(second.Started))
+	assert.False(t, second.Queued[0].End.Before(first.Finished))
+}
+
+func TestRetryBackoffIsQueued(t *testing.T) {
+	t.Parallel()
+
+	rg := &ResourceGraph{}
+	flaky := &failingEmitter{failures: 1}
+	flaky.Retry = RetryPolicy{MaxAttempts: 2, InitialBackoff: 30 * time.Millisecond}
+	rg.Register("flaky", flaky)
+
+	report, err := rg.MaterializeWithReport(context.Background())
+	require.NoError(t, err)
+	resource := report.Resources[0]
+	require.Len(t, resource.Queued, 1)
+	backoff := resource.Queued[0].End.Sub(resource.Queued[0].Start)
+	assert.True(t, backoff >= 30*time.Millisecond)
+	assert.Equal(t, resource.Finished.Sub(resource.Started)-backoff, resource.Duration())
+
+	buf := &bytes.Buffer{}
+	require.NoError(t, report.WriteTrace(buf))
+	trace := struct {
+		TraceEvents []traceEvent `json:"traceEvents"`
+	}{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &trace))
+	categories := []string{}
+	for _, event := range trace.TraceEvents {
+		if event.Category != "" {
+			categories = append(categories, event.Category)
+		}
+	}
+	assert.Equal(t, []string{"wait", "queued", "work", "work"}, categories)
+}
@@ -0,0 +1,103 @@
+package rfsb
+
+import (
+	"context"
+	"time"
+)
+
+// RunReport describes the outcome of a call to MaterializeWithReport. It can be serialized to JSON.
+type RunReport struct {
+	Started   time.Time        `json:"started"`
+	Finished  time.Time        `json:"finished"`
+	Resources []ResourceReport `json:"resources"`
+}
+
+// ResourceReport describes the outcome of a single Resource
+type ResourceReport struct {
+	// Name is the hierarchical name of the Resource
+	Name string `json:"name"`
+	// Signal is the final signal emitted for the Resource: Skipped, Materialized, Unevaluated or Failed. For a nested
+	// ResourceGraph, this summarizes its resources, preferring Failed, then Materialized, then Skipped.
+	Signal Signal `json:"signal"`
+	// Wait is how long after the start of the run the Resource's dependencies were resolved, i.e. how long it was
+	// blocked. ReleasedBy is the name of the dependency whose signal was the last the Resource waited for, and so is
+	// the Resource's predecessor on the critical path.
+	Wait       time.Duration `json:"wait"`
+	ReleasedBy string        `json:"released_by,omitempty"`
+	// Started and Finished are the times the evaluation of the Resource started and finished. Evaluation starts once
+	// the Resource holds its scheduler slot and lock keys. They are not set for Unevaluated resources, or for nested
+	// ResourceGraphs.
+	Started  time.Time `json:"started"`
+	Finished time.Time `json:"finished"`
+	// Queued lists the periods after the Resource's dependencies were resolved that it spent waiting rather than
+	// working: for its turn in Serial mode, for a scheduler slot, for lock keys, for the rest of its batch, or between
+	// retry attempts
+	Queued []Span `json:"queued,omitempty"`
+	// Signals lists the custom signals emitted by the Resource via EmitSignal
+	Signals []Signal `json:"signals,omitempty"`
+	// Error is the error returned by the Resource, if it Failed
+	Error string `json:"error,omitempty"`
+	// Inferred lists the names of the dependencies added by InferDependencies
+	Inferred []string `json:"inferred,omitempty"`
+	// BlockedBy lists the names of the dependencies that finished without emitting the signals the Resource waited
+	// for, causing it to be Unevaluated. It is empty if the Resource was Unevaluated due to a Condition.
+	BlockedBy []string `json:"blocked_by,omitempty"`
+	// Diff describes the changes made by the Resource, if it was materialized and implements Differ
+	Diff *Diff `json:"diff,omitempty"`
+	// NotSelected is true if the Resource was excluded from the run by the ResourceGraph's Selector
+	NotSelected bool `json:"not_selected,omitempty"`
+	// Replayed is true if the Resource was not evaluated, as it completed in a previous run recorded in the
+	// ResourceGraph's Journal. Signal and Signals are those recorded in the journal.
+	Replayed bool `json:"replayed,omitempty"`
+	// Reverted is true if the Resource was reverted after another Resource failed, as the ResourceGraph was
+	// Transactional. RevertError is set if reverting the Resource failed.
+	Reverted    bool   `json:"reverted,omitempty"`
+	RevertError string `json:"revert_error,omitempty"`
+}
+
+// Duration returns how long the Resource took to evaluate (calling ShouldSkip and Materialize), excluding the time it
+// spent queued once it had started
+func (rr *ResourceReport) Duration() time.Duration {
+	var duration time.Duration
+	for _, span := range rr.working() {
+		duration += span.End.Sub(span.Start)
+	}
+	return duration
+}
+
+// MaterializeWithReport materializes the ResourceGraph in the same manner as Materialize, additionally returning a
+// report of what happened to each Resource. The report is returned even if materialization fails, unless the graph
+// failed validation.
+func (rg *ResourceGraph) MaterializeWithReport(ctx context.Context) (*RunReport, error) {
+	if err := rg.validateAndMerge(); err != nil {
+		return nil, err
+	}
+
+	exec := &execution{graph: rg}
+	exec.evaluate = exec.materializeResource
+	exec.batching = true
+	if rg.Journal != "" {
+		journal, err := openJournal(rg.Journal)
+		if err != nil {
+			return nil, err
+		}
+		exec.journal = journal
+	}
+	err := exec.run(ctx)
+	if exec.journal != nil {
+		// Once the run has been rolled back, the recorded resources no longer reflect the state of the system
+		if journalErr := exec.journal.finish(err == nil || exec.rolledBack); journalErr != nil && err == nil {
+			err = journalErr
+		}
+	}
+	return exec.report(), err
+}
+
+// report builds the RunReport from the records collected by the execution
+func (e *execution) report() *RunReport {
+	report := &RunReport{Started: e.started, Finished: e.finished}
+	for _, r := range e.graph.resources {
+		report.Resources = append(report.Resources, *e.records[r])
+	}
+	return report
+}
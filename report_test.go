@@ -0,0 +1,49 @@
+package rfsb
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMaterializeWithReport(t *testing.T) {
+	t.Parallel()
+
+	rg := &ResourceGraph{KeepGoing: true}
+	changed := &testResource{}
+	skipped := &testResource{skip: true}
+	fails := &testResource{err: errors.New("oh no")}
+	afterSkipped := &testResource{}
+	rg.Register("changed", changed)
+	rg.Register("skipped", skipped)
+	rg.Register("fails", fails)
+	rg.When(skipped, Materialized).Do("afterSkipped", afterSkipped)
+
+	report, err := rg.MaterializeWithReport(context.Background())
+	require.IsType(t, &MaterializeError{}, err)
+	require.Len(t, report.Resources, 4)
+
+	assert.Equal(t, "changed", report.Resources[0].Name)
+	assert.Equal(t, Materialized, report.Resources[0].Signal)
+	assert.False(t, report.Resources[0].Started.IsZero())
+	assert.False(t, report.Resources[0].Finished.Before(report.Resources[0].Started))
+	assert.Equal(t, Skipped, report.Resources[1].Signal)
+	assert.Equal(t, Failed, report.Resources[2].Signal)
+	assert.Contains(t, report.Resources[2].Error, "oh no")
+	assert.Equal(t, Unevaluated, report.Resources[3].Signal)
+	assert.Equal(t, []string{"skipped"}, report.Resources[3].BlockedBy)
+	assert.True(t, report.Resources[3].Started.IsZero())
+
+	encoded, err := json.Marshal(report)
+	require.NoError(t, err)
+	assert.Contains(t, string(encoded), `"signal":"Materialized"`)
+
+	decoded := &RunReport{}
+	require.NoError(t, json.Unmarshal(encoded, decoded))
+	assert.Equal(t, Failed, decoded.Resources[2].Signal)
+	assert.Equal(t, []string{"skipped"}, decoded.Resources[3].BlockedBy)
+}
@@ -0,0 +1,76 @@
+package rfsb
+
+import (
+	"context"
+	"os"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// DirectoryResource ensures a directory exists at the given path, with the given mode and owner.
+//
+// It does not create parent directories. Each parent should have its own DirectoryResource.
+type DirectoryResource struct {
+	ResourceMeta
+	Path string
+	Mode os.FileMode
+	UID  uint32
+	GID  uint32
+}
+
+// LockKeys ensures that no two resources modify the same path at the same time
+func (dr *DirectoryResource) LockKeys() []string {
+	return []string{dr.Path}
+}
+
+// IdentityKeys identifies the directory by its path. Directories share their keys with FileResources, so that a file
+// and a directory at the same path conflict.
+func (dr *DirectoryResource) IdentityKeys() []string {
+	return []string{"file:" + dr.Path}
+}
+
+// ShouldSkip stats the directory to see if any modifications are required
+func (dr *DirectoryResource) ShouldSkip(context.Context) (bool, error) {
+	fi, err := os.Stat(dr.Path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			dr.Logger().Debugf("target does not exist")
+			return false, nil
+		}
+		return false, errors.Wrap(err, "could not stat directory")
+	}
+	if !fi.IsDir() {
+		return false, errors.Errorf("%v exists, but is not a directory", dr.Path)
+	}
+	if fi.Mode().Perm() != dr.Mode.Perm() {
+		dr.Logger().Infof("mode has changed (current: %v, desired: %v)", fi.Mode().Perm(), dr.Mode.Perm())
+		return false, nil
+	}
+	if sys, ok := fi.Sys().(*syscall.Stat_t); ok {
+		if sys.Uid != dr.UID || sys.Gid != dr.GID {
+			dr.Logger().Infof("uid/gid has changed (current: %v:%v)", sys.Uid, sys.Gid)
+			return false, nil
+		}
+	} else {
+		dr.Logger().Warn("could not test directory permissions as not linux")
+	}
+	return true, nil
+}
+
+// Materialize creates the directory if required, and sets its mode and owner
+func (dr *DirectoryResource) Materialize(context.Context) error {
+	err := os.Mkdir(dr.Path, dr.Mode.Perm())
+	if err != nil && !os.IsExist(err) {
+		return errors.Wrapf(err, "could not create %v", dr.Path)
+	}
+	err = os.Chmod(dr.Path, dr.Mode.Perm())
+	if err != nil {
+		return errors.Wrapf(err, "could not set mode of %v", dr.Path)
+	}
+	err = os.Chown(dr.Path, int(dr.UID), int(dr.GID))
+	if err != nil {
+		return errors.Wrapf(err, "could not set owner of %v", dr.Path)
+	}
+	return nil
+}
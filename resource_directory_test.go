@@ -0,0 +1,41 @@
+package rfsb
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var _ SkippableResource = &DirectoryResource{}
+
+func TestDirectoryResource(t *testing.T) {
+	t.Parallel()
+
+	scratchDir, err := ioutil.TempDir("", t.Name())
+	require.NoError(t, err)
+	defer os.RemoveAll(scratchDir)
+
+	dr := &DirectoryResource{
+		Path: scratchDir + "/dir",
+		Mode: 0750,
+		UID:  uint32(os.Getuid()),
+		GID:  uint32(os.Getgid()),
+	}
+	dr.SetName("dir")
+	shouldSkip, err := dr.ShouldSkip(context.Background())
+	require.NoError(t, err)
+	assert.False(t, shouldSkip)
+
+	require.NoError(t, dr.Materialize(context.Background()))
+	fi, err := os.Stat(dr.Path)
+	require.NoError(t, err)
+	assert.True(t, fi.IsDir())
+	assert.Equal(t, os.FileMode(0750), fi.Mode().Perm())
+	shouldSkip, err = dr.ShouldSkip(context.Background())
+	require.NoError(t, err)
+	assert.True(t, shouldSkip)
+}
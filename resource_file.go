@@ -2,11 +2,13 @@ package rfsb
 
 import (
 	"context"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"syscall"
 
 	"github.com/pkg/errors"
+	"github.com/pmezard/go-difflib/difflib"
 )
 
 // FileResource ensures the file at the given path has the given content, mode and owner.
@@ -19,6 +21,21 @@ type FileResource struct {
 	UID      uint32
 	GID      uint32
 	Contents string
+
+	snapshot *fileSnapshot
+}
+
+// fileSnapshot is the state of a file before it was materialized
+type fileSnapshot struct {
+	existed  bool
+	contents []byte
+	mode     os.FileMode
+	uid, gid int
+}
+
+// LockKeys ensures that no two FileResources write to the same path at the same time
+func (fr *FileResource) LockKeys() []string {
+	return []string{fr.Path}
 }
 
 // ShouldSkip stats and reads the file to see if any modifications are required.
@@ -32,7 +49,7 @@ func (fr *FileResource) ShouldSkip(context.Context) (bool, error) {
 		return false, errors.Wrap(err, "could not stat file")
 	}
 	if fi.Mode() != fr.Mode {
-		fr.Logger().Infof("mode has changed (current: %v)", fr.Mode)
+		fr.Logger().Infof("mode has changed (current: %v, desired: %v)", fi.Mode(), fr.Mode)
 		return false, nil
 	}
 	if sys, ok := fi.Sys().(*syscall.Stat_t); ok {
@@ -64,3 +81,101 @@ func (fr *FileResource) Materialize(ctx context.Context) error {
 	}
 	return nil
 }
+
+// Snapshot records the current content, mode and owner of the file, so that they can be restored by Revert
+func (fr *FileResource) Snapshot(context.Context) error {
+	fi, err := os.Stat(fr.Path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			fr.snapshot = &fileSnapshot{}
+			return nil
+		}
+		return errors.Wrap(err, "could not stat file")
+	}
+	contents, err := ioutil.ReadFile(fr.Path)
+	if err != nil {
+		return errors.Wrapf(err, "could not read %v", fr.Path)
+	}
+	snapshot := &fileSnapshot{existed: true, contents: contents, mode: fi.Mode(), uid: -1, gid: -1}
+	if sys, ok := fi.Sys().(*syscall.Stat_t); ok {
+		snapshot.uid = int(sys.Uid)
+		snapshot.gid = int(sys.Gid)
+	}
+	fr.snapshot = snapshot
+	return nil
+}
+
+// Revert restores the file to the state recorded by Snapshot. If the file did not exist, it is removed.
+func (fr *FileResource) Revert(context.Context) error {
+	if fr.snapshot == nil {
+		return errors.Errorf("no snapshot of %v to revert to", fr.Path)
+	}
+	if !fr.snapshot.existed {
+		if err := os.Remove(fr.Path); err != nil && !os.IsNotExist(err) {
+			return errors.Wrapf(err, "could not remove %v", fr.Path)
+		}
+		return nil
+	}
+	err := ioutil.WriteFile(fr.Path, fr.snapshot.contents, fr.snapshot.mode)
+	if err != nil {
+		return errors.Wrapf(err, "could not write to %v", fr.Path)
+	}
+	err = os.Chmod(fr.Path, fr.snapshot.mode)
+	if err != nil {
+		return errors.Wrapf(err, "could not set mode of %v", fr.Path)
+	}
+	err = os.Chown(fr.Path, fr.snapshot.uid, fr.snapshot.gid)
+	if err != nil {
+		return errors.Wrapf(err, "could not set owner of %v", fr.Path)
+	}
+	return nil
+}
+
+// Diff describes the changes to the file's content, mode and owner that Materialize would make
+func (fr *FileResource) Diff(context.Context) (*Diff, error) {
+	diff := &Diff{}
+	currentContents := ""
+	fi, err := os.Stat(fr.Path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return nil, errors.Wrap(err, "could not stat file")
+		}
+		diff.Missing = true
+	} else {
+		if fi.Mode() != fr.Mode {
+			diff.Fields = append(diff.Fields, FieldDiff{Field: "mode", Current: fi.Mode().String(), Desired: fr.Mode.String()})
+		}
+		if sys, ok := fi.Sys().(*syscall.Stat_t); ok {
+			if sys.Uid != fr.UID {
+				diff.Fields = append(diff.Fields, FieldDiff{Field: "uid", Current: fmt.Sprint(sys.Uid), Desired: fmt.Sprint(fr.UID)})
+			}
+			if sys.Gid != fr.GID {
+				diff.Fields = append(diff.Fields, FieldDiff{Field: "gid", Current: fmt.Sprint(sys.Gid), Desired: fmt.Sprint(fr.GID)})
+			}
+		}
+
+		contents, err := ioutil.ReadFile(fr.Path)
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not read %v", fr.Path)
+		}
+		currentContents = string(contents)
+	}
+
+	if currentContents != fr.Contents {
+		fromFile := fr.Path
+		if diff.Missing {
+			fromFile = "/dev/null"
+		}
+		diff.Content, err = difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+			A:        difflib.SplitLines(currentContents),
+			B:        difflib.SplitLines(fr.Contents),
+			FromFile: fromFile,
+			ToFile:   fr.Path,
+			Context:  3,
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "could not diff contents")
+		}
+	}
+	return diff, nil
+}
@@ -3,20 +3,83 @@ package rfsb
 import (
 	"bytes"
 	"context"
+	"fmt"
+	"sort"
 	"strings"
 	"sync"
-	"sync/atomic"
 	"time"
 
 	"github.com/pkg/errors"
-	"golang.org/x/sync/errgroup"
+	"github.com/sirupsen/logrus"
 )
 
 // ResourceGraph is a container for Resources and dependencies between them.
+//
+// When a ResourceGraph is registered with another ResourceGraph, its resources are flattened into the parent, but the
+// ResourceGraph itself remains a node in the parent graph. It finishes once all of its resources have finished, and
+// emits signals summarizing them:
+//
+//  - Materialized, if any of its resources were materialized
+//  - Skipped, if any of its resources were skipped
+//  - Failed, if any of its resources failed
+//  - Unevaluated, if none of its resources were evaluated
+//  - Evaluated, once all of its resources have finished, unless any of them failed
+//  - any custom signals emitted by its resources
+//
+// So When(graph) waits for the whole graph to finish, even if some of its resources were Unevaluated, but, as for any
+// other resource, is not met if the graph failed. When(graph, Materialized) is additionally only met if anything in it
+// changed. To instead require every leaf resource of the graph to emit the signal, use When(graph.Leaves(),
+// Materialized). The graph is reported with the first of Failed, Materialized, Skipped and Unevaluated that it emits.
 type ResourceGraph struct {
 	ResourceMeta
 
-	resources           []Resource
+	// KeepGoing controls what happens when a Resource fails. By default, the first failure cancels the evaluation of
+	// every other Resource. When KeepGoing is set, a failure only prevents the evaluation of the failed Resource's
+	// dependents, and Materialize returns a *MaterializeError listing every failure.
+	//
+	// KeepGoing is only respected on the ResourceGraph that Materialize is called on.
+	KeepGoing bool
+	// Observers are notified of events as the ResourceGraph is materialized. Like KeepGoing, Observers are only
+	// respected on the ResourceGraph that Materialize is called on.
+	Observers []Observer
+	// Serial causes the ResourceGraph to evaluate one Resource at a time, in a topological order, making logs and
+	// ordering bugs reproducible. Resources that could run at the same time are ordered by a pseudo-random permutation
+	// seeded by SerialSeed, so rerunning with the same seed replays the same order.
+	Serial     bool
+	SerialSeed int64
+	// Selector, if set, restricts Materialize to the matched resources and their dependencies
+	Selector *Selector
+	// Journal, if set, is the path of a checkpoint journal. Each resource that is skipped or materialized is recorded in
+	// the journal, along with a fingerprint of its configuration (see Fingerprinter). If Materialize is interrupted or
+	// fails, the next call replays the recorded signals of unchanged resources instead of evaluating them again, unless
+	// any of their dependencies were evaluated again. The journal is removed once Materialize succeeds.
+	Journal string
+	// Transactional causes Materialize to revert every Reversible resource it materialized if any resource fails,
+	// in the reverse of the order they were materialized. Resources that are not Reversible are left as they are. The
+	// resources are reverted even if the run failed because the context passed to Materialize was cancelled.
+	Transactional bool
+	// AutoRequire causes Validate, and so Materialize and Plan, to add the dependencies implied by what the built in
+	// resources refer to. See InferDependencies.
+	AutoRequire bool
+	// MaxConcurrency, if positive, limits how many resources are evaluated at once. ClassLimits additionally limits
+	// the resources of each class (see ResourceMeta.Class), e.g. {"CmdResource": 2}. When resources are waiting to run,
+	// those with the highest Priority are started first, followed by those with the longest chains of dependents.
+	//
+	// Like KeepGoing, the limits are only respected on the ResourceGraph that Materialize is called on.
+	MaxConcurrency int
+	ClassLimits    map[string]int
+
+	resources []Resource
+	subgraphs []*ResourceGraph
+	notifiers map[Resource]map[Resource]struct{}
+	// requirements holds, for each resource, the clauses that must all be satisfied before it can be evaluated
+	requirements map[Resource][]clause
+	// conditions holds, for each resource, the conditions that must all be true once its requirements are satisfied
+	conditions map[Resource][]*condition
+	// inferred holds, for each resource, the dependencies added by InferDependencies
+	inferred map[Resource]map[Resource]struct{}
+	// merged holds, for each resource, the identical resources that were merged into it (see Identifiable)
+	merged              map[Resource][]Resource
 	dependencies        map[Resource]map[Resource][]Signal
 	inverseDependencies map[Resource]map[Resource][]Signal
 }
@@ -28,6 +91,21 @@ func (rg *ResourceGraph) init() {
 	if len(rg.inverseDependencies) == 0 {
 		rg.inverseDependencies = map[Resource]map[Resource][]Signal{}
 	}
+	if len(rg.notifiers) == 0 {
+		rg.notifiers = map[Resource]map[Resource]struct{}{}
+	}
+	if len(rg.requirements) == 0 {
+		rg.requirements = map[Resource][]clause{}
+	}
+	if len(rg.conditions) == 0 {
+		rg.conditions = map[Resource][]*condition{}
+	}
+	if len(rg.inferred) == 0 {
+		rg.inferred = map[Resource]map[Resource]struct{}{}
+	}
+	if len(rg.merged) == 0 {
+		rg.merged = map[Resource][]Resource{}
+	}
 }
 
 // Register adds the Resource to the graph.
@@ -39,6 +117,27 @@ func (rg *ResourceGraph) Register(name string, r Resource) {
 
 	if otherRG, ok := r.(*ResourceGraph); ok {
 		rg.resources = append(rg.resources, otherRG.resources...)
+		rg.resources = append(rg.resources, otherRG)
+		rg.subgraphs = append(rg.subgraphs, otherRG)
+		for to, clauses := range otherRG.requirements {
+			rg.requirements[to] = append(rg.requirements[to], clauses...)
+		}
+		for to, conditions := range otherRG.conditions {
+			rg.conditions[to] = append(rg.conditions[to], conditions...)
+		}
+		for handler, notifiers := range otherRG.notifiers {
+			for notifier := range notifiers {
+				rg.addNotifier(notifier, handler)
+			}
+		}
+		for to, froms := range otherRG.inferred {
+			if _, ok := rg.inferred[to]; !ok {
+				rg.inferred[to] = map[Resource]struct{}{}
+			}
+			for from := range froms {
+				rg.inferred[to][from] = struct{}{}
+			}
+		}
 		for from, tos := range otherRG.dependencies {
 			for to, signals := range tos {
 				if _, ok := rg.dependencies[from]; !ok {
@@ -57,6 +156,11 @@ func (rg *ResourceGraph) Register(name string, r Resource) {
 				}
 			}
 		}
+		// The graph waits for all of its resources to finish, so it can summarize them
+		for _, member := range otherRG.members() {
+			rg.addEdge(member, Finished, otherRG)
+			rg.requirements[otherRG] = append(rg.requirements[otherRG], clause{alternative{{member, Finished}}})
+		}
 	} else {
 		rg.resources = append(rg.resources, r)
 	}
@@ -65,159 +169,608 @@ func (rg *ResourceGraph) Register(name string, r Resource) {
 // RegisterDependency adds a dependency between two resources. This ensures the second resource (`to`) will not be
 // Materialized before the first resource (`from`) has finished Materializing
 func (rg *ResourceGraph) RegisterDependency(from Resource, signal Signal, to Resource) {
-	froms := []Resource{from}
-	if fromRG, ok := from.(*ResourceGraph); ok {
-		froms = fromRG.leafResources()
-	}
-	tos := []Resource{to}
-	if toRG, ok := to.(*ResourceGraph); ok {
-		tos = toRG.rootResources()
+	rg.init()
+	for _, from := range sourceResources(from) {
+		for _, to := range targetResources(to) {
+			rg.addEdge(from, signal, to)
+			rg.requirements[to] = append(rg.requirements[to], clause{alternative{{from, signal}}})
+		}
 	}
+}
 
-	for _, from := range froms {
-		for _, to := range tos {
-			if _, ok := rg.dependencies[from]; !ok {
-				rg.dependencies[from] = map[Resource][]Signal{}
+// registerAnyOf adds a dependency that is met as soon as any one of the alternatives has been satisfied. The target
+// will only be Unevaluated if every alternative finishes without being satisfied.
+func (rg *ResourceGraph) registerAnyOf(alternatives clause, to Resource) {
+	rg.init()
+	expanded := clause{}
+	for _, alt := range alternatives {
+		expandedAlt := alternative{}
+		for _, dep := range alt {
+			for _, from := range sourceResources(dep.resource) {
+				expandedAlt = append(expandedAlt, dependency{from, dep.signal})
 			}
-			rg.dependencies[from][to] = append(rg.dependencies[from][to], signal)
-			if _, ok := rg.inverseDependencies[to]; !ok {
-				rg.inverseDependencies[to] = map[Resource][]Signal{}
+		}
+		expanded = append(expanded, expandedAlt)
+	}
+
+	for _, to := range targetResources(to) {
+		for _, alt := range expanded {
+			for _, dep := range alt {
+				rg.addEdge(dep.resource, dep.signal, to)
 			}
-			rg.inverseDependencies[to][from] = append(rg.inverseDependencies[to][from], signal)
 		}
+		rg.requirements[to] = append(rg.requirements[to], expanded)
+	}
+}
+
+func (rg *ResourceGraph) addEdge(from Resource, signal Signal, to Resource) {
+	if _, ok := rg.dependencies[from]; !ok {
+		rg.dependencies[from] = map[Resource][]Signal{}
 	}
+	rg.dependencies[from][to] = append(rg.dependencies[from][to], signal)
+	if _, ok := rg.inverseDependencies[to]; !ok {
+		rg.inverseDependencies[to] = map[Resource][]Signal{}
+	}
+	rg.inverseDependencies[to][from] = append(rg.inverseDependencies[to][from], signal)
+}
+
+// sourceResources expands the result of ResourceGraph.Leaves used as the source of a dependency into the leaf resources
+// of the graph
+func sourceResources(from Resource) []Resource {
+	if fromLeaves, ok := from.(*leaves); ok {
+		return fromLeaves.leafResources()
+	}
+	return []Resource{from}
+}
+
+// leaves is returned by ResourceGraph.Leaves
+type leaves struct {
+	*ResourceGraph
+}
+
+// Leaves returns a Resource that, when passed to When, And or Or, depends on each of the graph's leaf resources (those
+// that no other resource in the graph depends on) individually. For example, When(graph.Leaves(), Materialized) is
+// only met if every leaf resource is materialized, whereas When(graph, Materialized) is met if any resource in the
+// graph is materialized.
+//
+// The leaves are determined when the dependency is registered, so the graph should be fully populated beforehand.
+func (rg *ResourceGraph) Leaves() Resource {
+	return &leaves{rg}
 }
 
-// SetName sets the name for the resource, but also prepends the resource name to any registered resources, ensuring
-// that the resource hierachy is reflected in the logger naming
+// targetResources expands a ResourceGraph used as the target of a dependency into its root resources
+func targetResources(to Resource) []Resource {
+	if toRG, ok := to.(*ResourceGraph); ok {
+		return toRG.rootResources()
+	}
+	return []Resource{to}
+}
+
+// SetName sets the name for the resource, but also prepends the resource name to any registered resources, including
+// nested ResourceGraphs, ensuring that the resource hierachy is reflected in the logger naming
 func (rg *ResourceGraph) SetName(name string) {
 	rg.ResourceMeta.SetName(name)
 	for _, r := range rg.resources {
-		r.SetName(rg.Name() + "·" + r.Name())
+		// Nested graphs must not rename their resources, as they have already been flattened into this graph's
+		// resources
+		if sub, ok := r.(*ResourceGraph); ok {
+			sub.ResourceMeta.SetName(rg.Name() + "·" + sub.Name())
+		} else {
+			r.SetName(rg.Name() + "·" + r.Name())
+		}
+	}
+}
+
+// Materialize executes all of the resources in the resource graph. Resources will be materialized in parallel, while
+// not violating constraints introduced by RegisterDependency. The graph is checked with Validate before any resources
+// are evaluated.
+func (rg *ResourceGraph) Materialize(ctx context.Context) error {
+	_, err := rg.MaterializeWithReport(ctx)
+	return err
+}
+
+// ResourceFailure records the error returned when evaluating a Resource
+type ResourceFailure struct {
+	Resource Resource
+	Err      error
+}
+
+// MaterializeError is returned by Materialize when running in KeepGoing mode and one or more resources failed
+type MaterializeError struct {
+	Failures []ResourceFailure
+}
+
+func (me *MaterializeError) Error() string {
+	msgs := []string{}
+	for _, failure := range me.Failures {
+		msgs = append(msgs, failure.Err.Error())
 	}
+	return fmt.Sprintf("%d resources failed: %s", len(me.Failures), strings.Join(msgs, "; "))
 }
 
-func (rg *ResourceGraph) waitForSignals(ctx context.Context, ch <-chan Signal, sigs []Signal) (met bool, unemittedButExpected []Signal) {
-	expectedSignals := map[Signal]struct{}{}
-	for _, expectedSig := range sigs {
-		expectedSignals[expectedSig] = struct{}{}
+// materializeResource calls the resource's ShouldSkip method (if it has one), and then Materialize if it should not be
+// skipped. It returns the signal that should be emitted for the resource.
+func (e *execution) materializeResource(ctx context.Context, resource Resource) (Signal, error) {
+	if batchable, ok := resource.(Batchable); ok && e.batches != nil {
+		return e.materializeBatchable(ctx, batchable)
+	}
+	shouldSkip, err := e.prepare(ctx, resource)
+	if err != nil {
+		return Unevaluated, err
+	}
+	if shouldSkip {
+		return Skipped, nil
 	}
 
-	for {
-		var sig Signal
-		select {
-		case <-ctx.Done():
-			return false, nil
-		case sig = <-ch:
+	if e.graph.Transactional {
+		if err := e.snapshot(ctx, resource); err != nil {
+			return Unevaluated, err
 		}
-		_, found := expectedSignals[sig]
-		if found {
-			delete(expectedSignals, sig)
+	}
+	resource.Logger().Infof("materializing resource")
+	e.observers.MaterializeStarted(resource)
+	err = resource.Materialize(ctx)
+	e.observers.MaterializeFinished(resource, err)
+	if err != nil {
+		return Unevaluated, errors.Wrapf(err, "could not materialize resource %v", resource.Name())
+	}
+	return Materialized, nil
+}
+
+// prepare calls the resource's ShouldSkip method (if it has one), returning true if it should be skipped. Otherwise, the
+// changes Materialize would make are recorded.
+func (e *execution) prepare(ctx context.Context, resource Resource) (bool, error) {
+	if skippable, ok := resource.(SkippableResource); ok {
+		shouldSkip, err := skippable.ShouldSkip(ctx)
+		e.observers.ShouldSkipFinished(resource, shouldSkip, err)
+		if err != nil {
+			return false, errors.Wrapf(err, "could not determine if materialization should be skipped for %v", resource.Name())
 		}
-		if len(expectedSignals) == 0 {
+		if shouldSkip {
+			resource.Logger().Infof("skipping resource materialization")
 			return true, nil
 		}
-		if sig == Finished {
-			for s := range expectedSignals {
-				unemittedButExpected = append(unemittedButExpected, s)
-			}
-			return false, unemittedButExpected
-		}
 	}
+	e.records[resource].Diff = diffResource(ctx, resource)
+	return false, nil
 }
 
-// Materialize executes all of the resources in the resource graph. Resources will be materialized in parallel, while
-// not violating constraints introduced by RegisterDependency
-func (rg *ResourceGraph) Materialize(ctx context.Context) error {
+// execution holds the state required to run all of the resources in a ResourceGraph, respecting the dependencies
+// between them.
+type execution struct {
+	graph *ResourceGraph
+	// evaluate is called for every resource whose dependencies have been met, and returns the signal (Skipped or
+	// Materialized) that should be emitted for the resource
+	evaluate func(context.Context, Resource) (Signal, error)
+	// unevaluated is called, if set, for every resource whose dependencies finished without emitting the expected
+	// signals. It is passed the dependencies that were not met.
+	unevaluated func(Resource, []Resource)
+
+	locks     keyLocks
+	slots     *scheduler
+	observers multiObserver
+	// batching causes Batchable resources to be materialized in batches, via batches, which is set up by run
+	batching bool
+	batches  *batcher
+	// conditionResults holds the result of each condition checked during the run
+	conditionsLock   sync.Mutex
+	conditionResults map[*condition]*conditionResult
+	// journal, if set, is used to replay resources completed by a previous run, and to record completed resources
+	journal *journal
+	// snapshotted lists the Reversible resources snapshotted in Transactional mode, in the order they were
+	// materialized. rolledBack is set once they have been reverted.
+	snapshotsLock sync.Mutex
+	snapshotted   []Resource
+	rolledBack    bool
+	// records holds the outcome of each resource. Each record is only written to by the goroutine evaluating its
+	// resource.
+	records           map[Resource]*ResourceReport
+	started, finished time.Time
+}
+
+func (e *execution) run(ctx context.Context) error {
+	rg := e.graph
+	e.locks = newKeyLocks(rg.resources)
+	e.slots = newScheduler(rg)
+	e.observers = append(observersFrom(ctx), rg.Observers...)
+	selected := rg.selectedResources()
+	isSelected := make(map[Resource]bool, len(selected))
+	for _, r := range selected {
+		isSelected[r] = true
+	}
+	if rg.Selector != nil {
+		logrus.Infof("selected %d of %d resources", len(selected), len(rg.resources))
+	}
+	e.records = make(map[Resource]*ResourceReport, len(rg.resources))
+	for _, r := range rg.resources {
+		e.records[r] = &ResourceReport{Name: r.Name(), Signal: Unevaluated, NotSelected: !isSelected[r]}
+		for _, edge := range rg.Dependencies(r) {
+			if edge.Inferred {
+				e.records[r].Inferred = append(e.records[r].Inferred, edge.From.Name())
+			}
+		}
+	}
+	e.started = time.Now()
+	defer func() { e.finished = time.Now() }()
 	dependencyChans := make(map[Resource]map[Resource]chan Signal, len(rg.resources))
 	for to, froms := range rg.inverseDependencies {
 		dependencyChans[to] = make(map[Resource]chan Signal, len(froms))
 		for from := range froms {
-			dependencyChans[to][from] = make(chan Signal, 3)
+			// Each resource emits each signal at most once, so sends never block, even once the dependent has stopped
+			// reading or was not selected
+			dependencyChans[to][from] = make(chan Signal, int(firstCustomSignal)+customSignalCount())
 		}
 	}
 
-	grp, ctx := errgroup.WithContext(ctx)
-	for _, resource := range rg.resources {
+	index := rg.resourceIndex()
+	parentCtx := ctx
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	if e.batching {
+		e.batches = newBatcher(ctx, e.materializeBatch)
+	}
+
+	failuresLock := sync.Mutex{}
+	failures := []ResourceFailure{}
+	fail := func(resource Resource, err error) {
+		failuresLock.Lock()
+		defer failuresLock.Unlock()
+		failures = append(failures, ResourceFailure{Resource: resource, Err: err})
+		e.observers.ResourceFailed(resource, err)
+		if !rg.KeepGoing {
+			cancel()
+		}
+	}
+
+	var seq *sequencer
+	if rg.Serial {
+		logrus.Infof("evaluating resources serially with seed %d", rg.SerialSeed)
+		order := []Resource{}
+		for _, r := range rg.serialOrder(rg.SerialSeed) {
+			if isSelected[r] {
+				order = append(order, r)
+			}
+		}
+		seq = newSequencer(order)
+	}
+
+	grp := sync.WaitGroup{}
+	for _, resource := range selected {
 		resource := resource
 		emit := func(sig Signal) {
+			e.observers.SignalEmitted(resource, sig)
 			for to := range rg.dependencies[resource] {
 				dependencyChans[to][resource] <- sig
 			}
 		}
 
-		grp.Go(func() error {
+		grp.Add(1)
+		go func() {
+			defer grp.Done()
+			if seq != nil {
+				defer seq.done(resource)
+			}
 			defer emit(Finished)
 
-			var dependenciesFinishedButNotMet uint32
-			wg := sync.WaitGroup{}
-			for from, ch := range dependencyChans[resource] {
-				from := from
-				ch := ch
-
-				wg.Add(1)
-				go func() {
-					defer wg.Done()
-					met, unemitted := rg.waitForSignals(ctx, ch, rg.inverseDependencies[resource][from])
-					if met {
-						return
-					}
-					if len(unemitted) != 0 {
-						strUnemitted := []string{}
-						for _, s := range unemitted {
-							strUnemitted = append(strUnemitted, s.String())
-						}
-						resource.Logger().Infof(
-							"skipping due to %s finishing without emitting %s",
-							from.Name(),
-							strings.Join(strUnemitted, ", "))
+			unmet, received, releasedBy, err := e.waitForDependencies(ctx, resource, dependencyChans[resource])
+			if err != nil {
+				return
+			}
+			record := e.records[resource]
+			record.Wait = time.Since(e.started)
+			// As the serial order is topological, the resource's dependencies all take their turns before it does
+			if seq != nil {
+				resolved := time.Now()
+				waited, err := seq.wait(ctx, resource)
+				if waited {
+					e.queued(resource, resolved)
+				}
+				if err != nil {
+					return
+				}
+			}
+			if releasedBy != nil {
+				record.ReleasedBy = releasedBy.Name()
+			}
+			if _, ok := resource.(*ResourceGraph); ok {
+				var signals []Signal
+				record.Signal, signals = aggregateSignals(received)
+				defer func() {
+					for _, sig := range signals {
+						emit(sig)
 					}
-					atomic.AddUint32(&dependenciesFinishedButNotMet, 1)
 				}()
+				return
+			}
+			if batchable, ok := resource.(Batchable); ok && e.batches != nil {
+				e.batches.released(batchable)
+				defer e.batches.finished(batchable)
+			}
+			notified := false
+			for from := range rg.notifiers[resource] {
+				notified = notified || containsSignal(received[from], Materialized)
+			}
+			if len(rg.notifiers[resource]) != 0 && !notified {
+				resource.Logger().Infof("skipping as none of the resources notifying it were materialized")
+				for from := range rg.notifiers[resource] {
+					if !containsResource(unmet, from) {
+						unmet = append(unmet, from)
+					}
+				}
 			}
-			wg.Wait()
-			if ctx.Err() != nil {
-				return ctx.Err()
+
+			failed := func(err error) {
+				resource.Logger().Errorf("resource failed: %v", err)
+				record.Signal = Failed
+				record.Error = err.Error()
+				fail(resource, err)
 			}
 
-			if dependenciesFinishedButNotMet != 0 {
+			conditionsMet := true
+			if len(unmet) == 0 {
+				conditionsMet, err = e.checkConditions(ctx, resource)
+				if err != nil {
+					failed(err)
+					defer emit(Failed)
+					return
+				}
+			}
+			if len(unmet) != 0 || !conditionsMet {
+				sortByRegistration(index, unmet)
+				for _, from := range unmet {
+					record.BlockedBy = append(record.BlockedBy, from.Name())
+				}
+				if e.unevaluated != nil {
+					e.unevaluated(resource, unmet)
+				}
 				defer emit(Unevaluated)
-				return nil
+				return
+			}
+
+			if e.journal != nil {
+				if from := e.evaluatedDependency(received); from != nil {
+					resource.Logger().Infof("not replaying journal entry, as %v was evaluated again", from.Name())
+				} else if entry, ok := e.journal.replay(resource); ok {
+					resource.Logger().Infof("replaying %v from journal", entry.Signal)
+					record.Signal = entry.Signal
+					record.Signals = entry.Signals
+					record.Replayed = true
+					defer func() {
+						emit(entry.Signal)
+						emit(Evaluated)
+						for _, custom := range entry.Signals {
+							emit(custom)
+						}
+					}()
+					return
+				}
 			}
-			defer emit(Evaluated)
 
-			var shouldSkip bool
-			started := time.Now()
 			resource.Logger().Infof("evaluating resource")
-			if skippable, ok := resource.(SkippableResource); ok {
-				var err error
-				shouldSkip, err = skippable.ShouldSkip(ctx)
-				if err != nil {
-					return errors.Wrapf(err, "could not determine if materialization should be skipped for %v", resource.Name())
+			e.observers.EvaluationStarted(resource)
+			sig, signals, err := e.evaluateWithRetry(ctx, resource)
+			if !record.Started.IsZero() {
+				record.Finished = time.Now()
+			}
+			if err != nil {
+				failed(err)
+				defer emit(Failed)
+				return
+			}
+			record.Signal = sig
+			record.Signals = signals
+			defer func() {
+				for _, custom := range record.Signals {
+					emit(custom)
+				}
+			}()
+			defer emit(Evaluated)
+			defer emit(sig)
+			resource.Logger().Infof("resource evaluated in %v", record.Duration())
+			if e.journal != nil {
+				if err := e.journal.record(resource, sig, record.Signals); err != nil {
+					resource.Logger().Warnf("could not record resource in journal: %v", err)
 				}
 			}
-			if !shouldSkip {
-				resource.Logger().Infof("materializing resource")
-				err := resource.Materialize(ctx)
-				if err != nil {
-					return errors.Wrapf(err, "could not materialize resource %v", resource.Name())
+		}()
+	}
+	grp.Wait()
+
+	if rg.Transactional && len(failures) != 0 {
+		e.rollback()
+	}
+	if len(failures) == 0 {
+		return parentCtx.Err()
+	}
+	if !rg.KeepGoing {
+		return failures[0].Err
+	}
+	sort.SliceStable(failures, func(i, j int) bool { return index[failures[i].Resource] < index[failures[j].Resource] })
+	return &MaterializeError{Failures: failures}
+}
+
+// waitForDependencies blocks until the requirements of the resource have been met, or can no longer be met. It returns
+// the dependencies that finished without emitting the signals required of them (if the requirements were not met),
+// along with the signals received from each dependency, and the dependency whose signal was received last.
+func (e *execution) waitForDependencies(ctx context.Context, resource Resource, chans map[Resource]chan Signal) (unmet []Resource, received map[Resource][]Signal, releasedBy Resource, err error) {
+	type event struct {
+		from   Resource
+		signal Signal
+	}
+	events := make(chan event)
+	stop := make(chan struct{})
+	defer close(stop)
+	for from, ch := range chans {
+		go func(from Resource, ch <-chan Signal) {
+			for {
+				var sig Signal
+				select {
+				case sig = <-ch:
+				case <-stop:
+					return
+				}
+				select {
+				case events <- event{from, sig}:
+				case <-stop:
+					return
+				}
+				if sig == Finished {
+					return
+				}
+			}
+		}(from, ch)
+	}
+
+	received = map[Resource][]Signal{}
+	finished := map[Resource]bool{}
+	for {
+		met, pending, unemitted := e.graph.checkRequirements(resource, received, finished)
+		if met {
+			return nil, received, releasedBy, nil
+		}
+		if !pending {
+			for _, from := range e.graph.resources {
+				sigs, ok := unemitted[from]
+				if !ok {
+					continue
+				}
+				strUnemitted := []string{}
+				for _, s := range sigs {
+					strUnemitted = append(strUnemitted, s.String())
+				}
+				resource.Logger().Infof(
+					"skipping due to %s finishing without emitting %s",
+					from.Name(),
+					strings.Join(strUnemitted, ", "))
+				unmet = append(unmet, from)
+			}
+			return unmet, received, releasedBy, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, received, releasedBy, ctx.Err()
+		case ev := <-events:
+			releasedBy = ev.from
+			received[ev.from] = append(received[ev.from], ev.signal)
+			if ev.signal == Finished {
+				finished[ev.from] = true
+			}
+		}
+	}
+}
+
+// checkRequirements checks whether the signals received so far satisfy all of the resource's requirements. If they do
+// not, pending is true while a requirement could still be satisfied by a dependency that has not finished. Once
+// nothing is pending, unemitted holds the signals that were expected but not emitted, by dependency.
+func (rg *ResourceGraph) checkRequirements(resource Resource, received map[Resource][]Signal, finished map[Resource]bool) (met bool, pending bool, unemitted map[Resource][]Signal) {
+	met = true
+	unemitted = map[Resource][]Signal{}
+	for _, cl := range rg.requirements[resource] {
+		satisfied := false
+		impossible := true
+		missing := map[Resource][]Signal{}
+		for _, alt := range cl {
+			altSatisfied := true
+			altImpossible := false
+			for _, dep := range alt {
+				if containsSignal(received[dep.resource], dep.signal) {
+					continue
+				}
+				altSatisfied = false
+				if finished[dep.resource] {
+					altImpossible = true
+					missing[dep.resource] = append(missing[dep.resource], dep.signal)
+				}
+			}
+			satisfied = satisfied || altSatisfied
+			impossible = impossible && altImpossible
+		}
+
+		switch {
+		case satisfied:
+		case impossible:
+			met = false
+			for from, sigs := range missing {
+				for _, sig := range sigs {
+					if !containsSignal(unemitted[from], sig) {
+						unemitted[from] = append(unemitted[from], sig)
+					}
 				}
-				defer emit(Materialized)
-			} else {
-				resource.Logger().Infof("skipping resource materialization")
-				defer emit(Skipped)
 			}
-			resource.Logger().Infof("resource evaluated in %v", time.Now().Sub(started))
-			return nil
-		})
+		default:
+			met = false
+			pending = true
+		}
+	}
+	return met, pending, unemitted
+}
+
+// aggregateSignals returns the signal recorded for a ResourceGraph, along with the signals it emits before Finished,
+// given the signals received from each of its resources
+func aggregateSignals(received map[Resource][]Signal) (Signal, []Signal) {
+	seen := map[Signal]bool{}
+	for _, signals := range received {
+		for _, sig := range signals {
+			seen[sig] = true
+		}
+	}
+	// A graph with no resources has nothing to do
+	if len(received) == 0 {
+		seen[Skipped] = true
 	}
 
-	return grp.Wait()
+	signals := []Signal{}
+	for _, sig := range []Signal{Materialized, Skipped, Failed} {
+		if seen[sig] {
+			signals = append(signals, sig)
+		}
+	}
+	if !seen[Materialized] && !seen[Skipped] && !seen[Failed] {
+		signals = append(signals, Unevaluated)
+	}
+	// As with any other resource, a failure only lets the dependents waiting for Failed run
+	if !seen[Failed] {
+		signals = append(signals, Evaluated)
+	}
+	for sig := firstCustomSignal; sig < firstCustomSignal+Signal(customSignalCount()); sig++ {
+		if seen[sig] {
+			signals = append(signals, sig)
+		}
+	}
+
+	switch {
+	case seen[Failed]:
+		return Failed, signals
+	case seen[Materialized]:
+		return Materialized, signals
+	case seen[Skipped]:
+		return Skipped, signals
+	default:
+		return Unevaluated, signals
+	}
+}
+
+// members returns the resources registered with the graph, excluding nested graphs
+func (rg *ResourceGraph) members() []Resource {
+	members := []Resource{}
+	for _, resource := range rg.resources {
+		if _, ok := resource.(*ResourceGraph); !ok {
+			members = append(members, resource)
+		}
+	}
+	return members
+}
+
+// isMembership returns true if the dependency is that of a nested graph on one of its own resources
+func isMembership(from, to Resource) bool {
+	toRG, ok := to.(*ResourceGraph)
+	return ok && containsResource(toRG.resources, from)
 }
 
 func (rg *ResourceGraph) rootResources() []Resource {
 	roots := []Resource{}
-	for _, resource := range rg.resources {
+	for _, resource := range rg.members() {
 		if _, ok := rg.inverseDependencies[resource]; !ok {
 			roots = append(roots, resource)
 		}
@@ -225,10 +778,18 @@ func (rg *ResourceGraph) rootResources() []Resource {
 	return roots
 }
 
+// leafResources returns the resources that no other resource depends on. The dependencies of nested graphs on their
+// resources are ignored.
 func (rg *ResourceGraph) leafResources() []Resource {
 	leaves := []Resource{}
-	for _, resource := range rg.resources {
-		if _, ok := rg.dependencies[resource]; !ok {
+	for _, resource := range rg.members() {
+		leaf := true
+		for to := range rg.dependencies[resource] {
+			if _, ok := to.(*ResourceGraph); !ok {
+				leaf = false
+			}
+		}
+		if leaf {
 			leaves = append(leaves, resource)
 		}
 	}
@@ -266,51 +827,93 @@ func (rg *ResourceGraph) String() string {
 // When is the main API that should be used to register dependencies. It's most basic use is just simple chaining of
 // dependencies:
 func (rg *ResourceGraph) When(resource Resource, signals ...Signal) *DependencySetter {
-	if len(signals) == 0 {
-		signals = []Signal{Evaluated}
-	}
-	deps := []dependency{}
-	for _, sig := range signals {
-		deps = append(deps, dependency{resource, sig})
-	}
 	return &DependencySetter{
-		registry:     rg,
-		dependencies: deps,
+		registry: rg,
+		clauses:  []clause{{newAlternative(resource, signals)}},
 	}
 }
 
 type registry interface {
 	Register(string, Resource)
 	RegisterDependency(from Resource, signal Signal, to Resource)
+	registerAnyOf(alternatives clause, to Resource)
+	registerCondition(to Resource, check Condition)
 }
 
 // DependencySetter is a helper to improve the ergonomics of creating dependencies between resources
 type DependencySetter struct {
-	registry     registry
-	dependencies []dependency
+	registry   registry
+	clauses    []clause
+	conditions []Condition
 }
 
+// dependency is a signal that must be emitted by a resource
 type dependency struct {
 	resource Resource
 	signal   Signal
 }
 
-// And adds an additional resource that must be completed before the Resource passed to Do will be run
-func (ds *DependencySetter) And(source Resource, signals ...Signal) *DependencySetter {
+// alternative is satisfied when all of its dependencies have been emitted
+type alternative []dependency
+
+// clause is satisfied when any one of its alternatives is satisfied
+type clause []alternative
+
+func newAlternative(source Resource, signals []Signal) alternative {
 	if len(signals) == 0 {
 		signals = []Signal{Evaluated}
 	}
+	alt := alternative{}
 	for _, signal := range signals {
-		ds.dependencies = append(ds.dependencies, dependency{source, signal})
+		alt = append(alt, dependency{source, signal})
 	}
+	return alt
+}
+
+// And adds an additional resource that must be completed before the Resource passed to Do will be run
+func (ds *DependencySetter) And(source Resource, signals ...Signal) *DependencySetter {
+	ds.clauses = append(ds.clauses, clause{newAlternative(source, signals)})
 	return ds
 }
 
-// Do registers the passed Resource as being dependent on the Resources passed to When and And
+// Or adds an alternative to the preceding When, And or Or call. The Resource passed to Do will be run as soon as any
+// one of the alternatives has emitted its signals, and will only be Unevaluated if all of them finish without doing
+// so. For example, to reload nginx if either its certificate or its config changes:
+//
+//	rg.When(cert, Materialized).Or(config, Materialized).Do("reload", reload)
+//
+// Or binds more tightly than And, so When(a).Or(b).And(c) waits for either a or b, and for c.
+func (ds *DependencySetter) Or(source Resource, signals ...Signal) *DependencySetter {
+	last := len(ds.clauses) - 1
+	ds.clauses[last] = append(ds.clauses[last], newAlternative(source, signals))
+	return ds
+}
+
+// If adds a condition that is checked at run time, after all of the dependencies have been met. If the condition
+// returns false, the Resource passed to Do is Unevaluated, exactly as if its dependencies had not been met. If it
+// returns an error, the Resource fails. If a ResourceGraph is passed to Do, the condition is checked once, and gates
+// all of the graph's root resources.
+//
+// Conditions are also checked by Plan, so should not have side effects.
+func (ds *DependencySetter) If(condition Condition) *DependencySetter {
+	ds.conditions = append(ds.conditions, condition)
+	return ds
+}
+
+// Do registers the passed Resource as being dependent on the Resources passed to When, And and Or
 func (ds *DependencySetter) Do(name string, target Resource) *DependencySetter {
 	ds.registry.Register(name, target)
-	for _, dependency := range ds.dependencies {
-		ds.registry.RegisterDependency(dependency.resource, dependency.signal, target)
+	for _, cl := range ds.clauses {
+		if len(cl) == 1 {
+			for _, dependency := range cl[0] {
+				ds.registry.RegisterDependency(dependency.resource, dependency.signal, target)
+			}
+		} else {
+			ds.registry.registerAnyOf(cl, target)
+		}
+	}
+	for _, condition := range ds.conditions {
+		ds.registry.registerCondition(target, condition)
 	}
 	return ds
 }
@@ -24,7 +24,9 @@ func ExampleResourceGraph_When() {
 	rg.When(firstFile).Do("firstFile", secondFile)
 }
 
-func ExampleResourceGraph_When_And() {
+// The suffixes of the examples below must start with a lower case letter, or go vet reports them as malformed
+
+func ExampleResourceGraph_When_and() {
 	rg := &ResourceGraph{}
 
 	user := &UserResource{
@@ -49,7 +51,7 @@ func ExampleResourceGraph_When_And() {
 	rg.When(user).And(group).Do("membership", membership)
 }
 
-func ExampleResourceGraph_When_Optional() {
+func ExampleResourceGraph_When_optional() {
 	rg := &ResourceGraph{}
 
 	sshdConf := &FileResource{
@@ -1,17 +1,22 @@
 package rfsb
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 	"math/rand"
 	"os"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 // TestResourceGraphFlattening tests that when we flatten a ResourceGraph into another ResourceGraph, all of the
-// resources are preserved
+// resources are preserved, and the flattened graph remains a node of its own
 func TestResourceGraphFlattening(t *testing.T) {
 	t.Parallel()
 
@@ -24,7 +29,7 @@ func TestResourceGraphFlattening(t *testing.T) {
 	outerRG := &ResourceGraph{}
 	outerRG.Register("inner", innerRG)
 
-	assert.ElementsMatch(t, outerRG.resources, innerRG.resources)
+	assert.Equal(t, []Resource{r1, r2, innerRG}, outerRG.resources)
 }
 
 func mkArbitraryResource(t *testing.T) Resource {
@@ -42,3 +47,348 @@ func mkArbitraryResource(t *testing.T) Resource {
 		GID:      uint32(os.Getgid()),
 	}
 }
+
+// testResource is a SkippableResource that does not touch the system, recording how many times it was materialized
+type testResource struct {
+	ResourceMeta
+	skip         bool
+	err          error
+	materialized int32
+}
+
+func (tr *testResource) ShouldSkip(context.Context) (bool, error) {
+	return tr.skip, nil
+}
+
+func (tr *testResource) Materialize(context.Context) error {
+	atomic.AddInt32(&tr.materialized, 1)
+	return tr.err
+}
+
+func TestResourceGraphMaterialize(t *testing.T) {
+	t.Parallel()
+
+	rg := &ResourceGraph{}
+	changed := &testResource{}
+	skipped := &testResource{skip: true}
+	afterChanged := &testResource{}
+	afterSkipped := &testResource{}
+	rg.Register("changed", changed)
+	rg.Register("skipped", skipped)
+	rg.When(changed, Materialized).Do("afterChanged", afterChanged)
+	rg.When(skipped, Materialized).Do("afterSkipped", afterSkipped)
+
+	err := rg.Materialize(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), changed.materialized)
+	assert.Equal(t, int32(0), skipped.materialized)
+	assert.Equal(t, int32(1), afterChanged.materialized)
+	assert.Equal(t, int32(0), afterSkipped.materialized)
+}
+
+func TestResourceGraphKeepGoing(t *testing.T) {
+	t.Parallel()
+
+	rg := &ResourceGraph{KeepGoing: true}
+	fails := &testResource{err: errors.New("failed")}
+	alsoFails := &testResource{err: errors.New("also failed")}
+	afterFails := &testResource{}
+	cleanup := &testResource{}
+	unrelated := &testResource{}
+	rg.Register("fails", fails)
+	rg.Register("alsoFails", alsoFails)
+	rg.Register("unrelated", unrelated)
+	rg.When(fails).Do("afterFails", afterFails)
+	rg.When(fails, Failed).Do("cleanup", cleanup)
+
+	err := rg.Materialize(context.Background())
+	require.IsType(t, &MaterializeError{}, err)
+	failures := err.(*MaterializeError).Failures
+	require.Len(t, failures, 2)
+	assert.Equal(t, fails, failures[0].Resource)
+	assert.Equal(t, alsoFails, failures[1].Resource)
+
+	assert.Equal(t, int32(1), unrelated.materialized)
+	assert.Equal(t, int32(0), afterFails.materialized)
+	assert.Equal(t, int32(1), cleanup.materialized)
+}
+
+func TestResourceGraphFailFast(t *testing.T) {
+	t.Parallel()
+
+	rg := &ResourceGraph{}
+	fails := &testResource{err: errors.New("failed")}
+	afterFails := &testResource{}
+	rg.Register("fails", fails)
+	rg.When(fails, Failed).Do("afterFails", afterFails)
+
+	err := rg.Materialize(context.Background())
+	require.Error(t, err)
+	assert.Equal(t, "failed", errors.Cause(err).Error())
+	assert.Equal(t, int32(0), afterFails.materialized)
+}
+
+func TestDependencySetterOr(t *testing.T) {
+	t.Parallel()
+
+	rg := &ResourceGraph{}
+	cert := &testResource{}
+	slowConfig := &gatedResource{gate: make(chan struct{})}
+	rg.Register("cert", cert)
+	rg.Register("slowConfig", slowConfig)
+	reload := &testResource{}
+	rg.When(cert, Materialized).Or(slowConfig, Materialized).Do("reload", reload)
+
+	unchangedA := &testResource{skip: true}
+	unchangedB := &testResource{skip: true}
+	rg.Register("unchangedA", unchangedA)
+	rg.Register("unchangedB", unchangedB)
+	neverReloaded := &testResource{}
+	rg.When(unchangedA, Materialized).Or(unchangedB, Materialized).Do("neverReloaded", neverReloaded)
+
+	andedWithOr := &testResource{}
+	rg.When(unchangedA, Materialized).Or(cert, Materialized).And(unchangedB, Skipped).Do("andedWithOr", andedWithOr)
+
+	done := make(chan *RunReport)
+	go func() {
+		report, err := rg.MaterializeWithReport(context.Background())
+		assert.NoError(t, err)
+		done <- report
+	}()
+	// reload is released as soon as cert materializes, without waiting for slowConfig
+	for atomic.LoadInt32(&reload.materialized) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	close(slowConfig.gate)
+	report := <-done
+
+	assert.Equal(t, int32(1), reload.materialized)
+	assert.Equal(t, int32(0), neverReloaded.materialized)
+	assert.Equal(t, []string{"unchangedA", "unchangedB"}, report.Resources[5].BlockedBy)
+	assert.Equal(t, int32(1), andedWithOr.materialized)
+}
+
+func TestDependencySetterIf(t *testing.T) {
+	t.Parallel()
+
+	rg := &ResourceGraph{KeepGoing: true}
+	first := &testResource{}
+	rg.Register("first", first)
+	met := &testResource{}
+	rg.When(first).If(func(context.Context) (bool, error) { return true, nil }).Do("met", met)
+	notMet := &testResource{}
+	rg.When(first).If(func(context.Context) (bool, error) { return false, nil }).Do("notMet", notMet)
+	afterNotMet := &testResource{}
+	rg.When(notMet).Do("afterNotMet", afterNotMet)
+	cleanup := &testResource{}
+	rg.When(notMet, Unevaluated).Do("cleanup", cleanup)
+	broken := &testResource{}
+	rg.When(first).If(func(context.Context) (bool, error) { return false, errors.New("broken") }).Do("broken", broken)
+
+	report, err := rg.MaterializeWithReport(context.Background())
+	require.IsType(t, &MaterializeError{}, err)
+	failures := err.(*MaterializeError).Failures
+	require.Len(t, failures, 1)
+	assert.Equal(t, broken, failures[0].Resource)
+	assert.Equal(t, "broken", errors.Cause(failures[0].Err).Error())
+
+	assert.Equal(t, int32(1), met.materialized)
+	assert.Equal(t, int32(0), notMet.materialized)
+	assert.Equal(t, Unevaluated, report.Resources[2].Signal)
+	assert.Empty(t, report.Resources[2].BlockedBy)
+	assert.Equal(t, int32(0), afterNotMet.materialized)
+	assert.Equal(t, int32(1), cleanup.materialized)
+	assert.Equal(t, int32(0), broken.materialized)
+	assert.Equal(t, Failed, report.Resources[5].Signal)
+}
+
+func TestDependencySetterIfGraph(t *testing.T) {
+	t.Parallel()
+
+	sub := &ResourceGraph{}
+	roots := []*testResource{{}, {}, {}}
+	for i, root := range roots {
+		sub.Register(fmt.Sprintf("root%d", i), root)
+	}
+	checks := int32(0)
+	rg := &ResourceGraph{}
+	first := &testResource{}
+	rg.Register("first", first)
+	rg.When(first).If(func(context.Context) (bool, error) {
+		// Each check gives a different answer, so the roots would disagree if it was checked for each of them
+		return atomic.AddInt32(&checks, 1) == 1, nil
+	}).Do("sub", sub)
+
+	require.NoError(t, rg.Materialize(context.Background()))
+	assert.Equal(t, int32(1), checks)
+	for _, root := range roots {
+		assert.Equal(t, int32(1), root.materialized)
+	}
+
+	// Each run checks the condition again
+	require.NoError(t, rg.Materialize(context.Background()))
+	assert.Equal(t, int32(2), checks)
+	for _, root := range roots {
+		assert.Equal(t, int32(1), root.materialized)
+	}
+}
+
+func TestResourceGraphNestedNames(t *testing.T) {
+	t.Parallel()
+
+	// Nested graphs are named hierarchically, like the resources registered with them, however deeply they are nested
+	inner := &ResourceGraph{}
+	file := &testResource{}
+	inner.Register("file", file)
+	middle := &ResourceGraph{}
+	middle.Register("inner", inner)
+	outer := &ResourceGraph{}
+	outer.Register("middle", middle)
+
+	assert.Equal(t, "middle", middle.Name())
+	assert.Equal(t, "middle·inner", inner.Name())
+	assert.Equal(t, "middle·inner·file", file.Name())
+	found, ok := outer.Lookup("middle·inner")
+	assert.True(t, ok)
+	assert.Equal(t, inner, found)
+	_, ok = outer.Lookup("inner")
+	assert.False(t, ok)
+}
+
+func TestResourceGraphAggregateSignals(t *testing.T) {
+	t.Parallel()
+
+	changed := &ResourceGraph{}
+	changed.Register("materialized", &testResource{})
+	changed.Register("skipped", &testResource{skip: true})
+	unchanged := &ResourceGraph{}
+	unchanged.Register("skipped", &testResource{skip: true})
+	outer := &ResourceGraph{}
+	outer.Register("changed", changed)
+	outer.Register("unchanged", unchanged)
+
+	rg := &ResourceGraph{KeepGoing: true}
+	rg.Register("outer", outer)
+	anyChanged := &testResource{}
+	rg.When(changed, Materialized).Do("anyChanged", anyChanged)
+	allChanged := &testResource{}
+	rg.When(changed.Leaves(), Materialized).Do("allChanged", allChanged)
+	noneChanged := &testResource{}
+	rg.When(unchanged, Skipped).Do("noneChanged", noneChanged)
+	outerChanged := &testResource{}
+	rg.When(outer, Materialized).Do("outerChanged", outerChanged)
+
+	failing := &ResourceGraph{}
+	failing.Register("fails", &testResource{err: errors.New("failed")})
+	failing.Register("materialized", &testResource{})
+	rg.Register("failing", failing)
+	afterFailing := &testResource{}
+	rg.When(failing).Do("afterFailing", afterFailing)
+	cleanup := &testResource{}
+	rg.When(failing, Failed).Do("cleanup", cleanup)
+
+	// A graph whose resources were not triggered is still Evaluated once they have all finished
+	optional := &ResourceGraph{}
+	trigger := &testResource{skip: true}
+	rg.Register("trigger", trigger)
+	optional.When(trigger, Materialized).Do("handler", &testResource{})
+	rg.Register("optional", optional)
+	afterOptional := &testResource{}
+	rg.When(optional).Do("afterOptional", afterOptional)
+	optionalChanged := &testResource{}
+	rg.When(optional, Materialized).Do("optionalChanged", optionalChanged)
+	optionalSkipped := &testResource{}
+	rg.When(optional, Skipped).Do("optionalSkipped", optionalSkipped)
+
+	report, err := rg.MaterializeWithReport(context.Background())
+	require.IsType(t, &MaterializeError{}, err)
+	assert.Len(t, err.(*MaterializeError).Failures, 1)
+
+	assert.Equal(t, int32(1), anyChanged.materialized)
+	assert.Equal(t, int32(0), allChanged.materialized)
+	assert.Equal(t, int32(1), noneChanged.materialized)
+	assert.Equal(t, int32(1), outerChanged.materialized)
+	assert.Equal(t, int32(0), afterFailing.materialized)
+	assert.Equal(t, int32(1), cleanup.materialized)
+	assert.Equal(t, int32(1), afterOptional.materialized)
+	assert.Equal(t, int32(0), optionalChanged.materialized)
+	assert.Equal(t, int32(0), optionalSkipped.materialized)
+
+	signals := map[string]Signal{}
+	blockedBy := map[string][]string{}
+	for _, rr := range report.Resources {
+		signals[rr.Name] = rr.Signal
+		blockedBy[rr.Name] = rr.BlockedBy
+	}
+	assert.Equal(t, Materialized, signals["outer·changed"])
+	assert.Equal(t, Skipped, signals["outer·unchanged"])
+	assert.Equal(t, Materialized, signals["outer"])
+	assert.Equal(t, Failed, signals["failing"])
+	assert.Equal(t, Unevaluated, signals["optional"])
+	assert.Equal(t, []string{"failing"}, blockedBy["afterFailing"])
+}
+
+func TestResourceGraphAggregateWaitsForAllResources(t *testing.T) {
+	t.Parallel()
+
+	sub := &ResourceGraph{}
+	fast := &closingResource{done: make(chan struct{})}
+	sub.Register("fast", fast)
+	slow := &gatedResource{gate: make(chan struct{})}
+	sub.Register("slow", slow)
+
+	rg := &ResourceGraph{}
+	rg.Register("sub", sub)
+	after := &testResource{}
+	rg.When(sub, Materialized).Do("after", after)
+
+	done := make(chan error)
+	go func() {
+		done <- rg.Materialize(context.Background())
+	}()
+	<-fast.done
+	assert.Equal(t, int32(1), atomic.LoadInt32(&fast.materialized))
+	assert.Equal(t, int32(0), atomic.LoadInt32(&after.materialized))
+	close(slow.gate)
+	require.NoError(t, <-done)
+	assert.Equal(t, int32(1), after.materialized)
+}
+
+func TestResourceGraphAggregateDoesNotBlock(t *testing.T) {
+	t.Parallel()
+
+	// The graph emits Materialized, Failed and custom signals, which must not block once its dependents have stopped
+	// listening
+	mkGraph := func() *ResourceGraph {
+		g := &ResourceGraph{}
+		g.Register("emits", &emittingResource{signals: []Signal{testConfigChanged, testPackageUpgraded}})
+		g.Register("fails", &testResource{err: errors.New("failed")})
+		g.Register("skipped", &testResource{skip: true})
+		return g
+	}
+
+	or := &ResourceGraph{KeepGoing: true}
+	orGraph := mkGraph()
+	or.Register("g", orGraph)
+	first := &testResource{}
+	or.Register("first", first)
+	or.When(first).Or(orGraph).Do("after", &testResource{})
+
+	selected := &ResourceGraph{KeepGoing: true, Selector: &Selector{Names: []string{"g"}}}
+	selectedGraph := mkGraph()
+	selected.Register("g", selectedGraph)
+	selected.When(selectedGraph).Do("after", &testResource{})
+
+	for _, rg := range []*ResourceGraph{or, selected} {
+		done := make(chan error)
+		go func(rg *ResourceGraph) {
+			done <- rg.Materialize(context.Background())
+		}(rg)
+		select {
+		case err := <-done:
+			require.IsType(t, &MaterializeError{}, err)
+		case <-time.After(5 * time.Second):
+			t.Fatal("Materialize did not return")
+		}
+	}
+}
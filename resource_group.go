@@ -15,6 +15,13 @@ type GroupResource struct {
 	ResourceMeta
 	Group string
 	GID   uint32
+
+	snapshot *entrySnapshot
+}
+
+// LockKeys ensures that no other resource rewrites /etc/group while the group is being created
+func (gr *GroupResource) LockKeys() []string {
+	return []string{"/etc/group"}
 }
 
 // ShouldSkip tests that the group exists and has the correct name
@@ -74,6 +81,87 @@ func (gr *GroupResource) Materialize(context.Context) error {
 	return nil
 }
 
+// Snapshot records the group's current name, so that it can be restored by Revert
+func (gr *GroupResource) Snapshot(context.Context) error {
+	groupContents, err := ioutil.ReadFile("/etc/group")
+	if err != nil {
+		return errors.Wrap(err, "could not read /etc/group")
+	}
+	gr.snapshot = gr.snapshotGroup(string(groupContents))
+	return nil
+}
+
+func (gr *GroupResource) snapshotGroup(groupContents string) *entrySnapshot {
+	for _, line := range strings.Split(groupContents, "\n") {
+		parts := strings.Split(line, ":")
+		if len(parts) == 4 && parts[2] == strconv.Itoa(int(gr.GID)) {
+			return &entrySnapshot{entry: parts[0], existed: true}
+		}
+	}
+	return &entrySnapshot{}
+}
+
+// Revert restores the name of the group to the one recorded by Snapshot. If the group did not exist, it is removed.
+// Group members, and the rest of /etc/group, are left as they are.
+func (gr *GroupResource) Revert(context.Context) error {
+	if gr.snapshot == nil {
+		return errors.Errorf("no snapshot of group %v to revert to", gr.Group)
+	}
+	groupContents, err := ioutil.ReadFile("/etc/group")
+	if err != nil {
+		return errors.Wrap(err, "could not read /etc/group")
+	}
+	err = ioutil.WriteFile("/etc/group", []byte(gr.revertGroup(string(groupContents))), 0644)
+	if err != nil {
+		return errors.Wrap(err, "failed to write to /etc/group")
+	}
+	return nil
+}
+
+func (gr *GroupResource) revertGroup(groupContents string) string {
+	newContents := bytes.NewBuffer(nil)
+	for _, line := range strings.Split(groupContents, "\n") {
+		if len(line) == 0 {
+			continue
+		}
+		parts := strings.Split(line, ":")
+		if len(parts) == 4 && parts[2] == strconv.Itoa(int(gr.GID)) {
+			if !gr.snapshot.existed {
+				continue
+			}
+			parts[0] = gr.snapshot.entry
+			line = strings.Join(parts, ":")
+		}
+		newContents.WriteString(line)
+		newContents.WriteByte('\n')
+	}
+	return newContents.String()
+}
+
+// Diff describes the changes to the group's /etc/group entry that Materialize would make
+func (gr *GroupResource) Diff(context.Context) (*Diff, error) {
+	groupContents, err := ioutil.ReadFile("/etc/group")
+	if err != nil {
+		return nil, errors.Wrap(err, "could not read /etc/group")
+	}
+	return gr.diffGroup(string(groupContents)), nil
+}
+
+func (gr *GroupResource) diffGroup(groupContents string) *Diff {
+	for _, line := range strings.Split(groupContents, "\n") {
+		parts := strings.Split(line, ":")
+		if len(parts) != 4 || parts[2] != strconv.Itoa(int(gr.GID)) {
+			continue
+		}
+		diff := &Diff{}
+		if parts[0] != gr.Group {
+			diff.Fields = append(diff.Fields, FieldDiff{Field: "group", Current: parts[0], Desired: gr.Group})
+		}
+		return diff
+	}
+	return &Diff{Missing: true}
+}
+
 // GroupMembershipResource ensures that a user belongs to a group
 type GroupMembershipResource struct {
 	ResourceMeta
@@ -81,6 +169,11 @@ type GroupMembershipResource struct {
 	User string
 }
 
+// LockKeys ensures that no other resource rewrites /etc/group while the user is being added
+func (gmr *GroupMembershipResource) LockKeys() []string {
+	return []string{"/etc/group"}
+}
+
 // ShouldSkip tests that the user belongs to the group
 func (gmr *GroupMembershipResource) ShouldSkip(context.Context) (bool, error) {
 	groupContents, err := ioutil.ReadFile("/etc/group")
@@ -139,3 +232,99 @@ func (gmr *GroupMembershipResource) Materialize(context.Context) error {
 	}
 	return nil
 }
+
+// BatchKey allows all GroupMembershipResources to be materialized together, as they all rewrite /etc/group
+func (gmr *GroupMembershipResource) BatchKey() string {
+	return ""
+}
+
+// MaterializeBatch adds each of the users to their groups, reading and rewriting /etc/group once
+func (gmr *GroupMembershipResource) MaterializeBatch(ctx context.Context, batch []Resource) []error {
+	errs := make([]error, len(batch))
+	groupContents, err := ioutil.ReadFile("/etc/group")
+	if err != nil {
+		for i := range errs {
+			errs[i] = errors.Wrap(err, "could not read /etc/group")
+		}
+		return errs
+	}
+
+	memberships := make([]*GroupMembershipResource, len(batch))
+	for i, r := range batch {
+		memberships[i] = r.(*GroupMembershipResource)
+	}
+	newContents, errs := addGroupMembers(string(groupContents), memberships)
+	err = ioutil.WriteFile("/etc/group", []byte(newContents), 0644)
+	if err != nil {
+		for i := range errs {
+			if errs[i] == nil {
+				errs[i] = errors.Wrap(err, "failed to write to /etc/group")
+			}
+		}
+	}
+	return errs
+}
+
+// addGroupMembers adds each user to their group, returning an error for each membership whose group does not exist
+func addGroupMembers(groupContents string, memberships []*GroupMembershipResource) (string, []error) {
+	errs := make([]error, len(memberships))
+	added := make([]bool, len(memberships))
+	newContents := bytes.NewBuffer(nil)
+	for _, line := range strings.Split(groupContents, "\n") {
+		if len(line) == 0 {
+			continue
+		}
+		parts := strings.Split(line, ":")
+		if len(parts) == 4 {
+			for i, gmr := range memberships {
+				if parts[2] != strconv.Itoa(int(gmr.GID)) {
+					continue
+				}
+				added[i] = true
+				if parts[3] != "" {
+					parts[3] += ","
+				}
+				parts[3] += gmr.User
+			}
+			line = strings.Join(parts, ":")
+		}
+		newContents.WriteString(line)
+		newContents.WriteByte('\n')
+	}
+	for i, gmr := range memberships {
+		if !added[i] {
+			errs[i] = errors.Errorf("/etc/group did not contain group %v", gmr.GID)
+		}
+	}
+	return newContents.String(), errs
+}
+
+// Diff describes the change to the group's member list that Materialize would make
+func (gmr *GroupMembershipResource) Diff(context.Context) (*Diff, error) {
+	groupContents, err := ioutil.ReadFile("/etc/group")
+	if err != nil {
+		return nil, errors.Wrap(err, "could not read /etc/group")
+	}
+	return gmr.diffGroup(string(groupContents))
+}
+
+func (gmr *GroupMembershipResource) diffGroup(groupContents string) (*Diff, error) {
+	for _, line := range strings.Split(groupContents, "\n") {
+		parts := strings.Split(line, ":")
+		if len(parts) != 4 || parts[2] != strconv.Itoa(int(gmr.GID)) {
+			continue
+		}
+		members := []string{}
+		if parts[3] != "" {
+			members = strings.Split(parts[3], ",")
+		}
+		for _, member := range members {
+			if member == gmr.User {
+				return &Diff{}, nil
+			}
+		}
+		desired := strings.Join(append(members, gmr.User), ",")
+		return &Diff{Fields: []FieldDiff{{Field: "members", Current: parts[3], Desired: desired}}}, nil
+	}
+	return nil, errors.Errorf("/etc/group did not contain group %v", gmr.GID)
+}
@@ -1,6 +1,30 @@
 package rfsb
 
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
 var (
-	_ Resource = &GroupResource{}
-	_ Resource = &GroupMembershipResource{}
+	_ Resource  = &GroupResource{}
+	_ Resource  = &GroupMembershipResource{}
+	_ Batchable = &GroupMembershipResource{}
 )
+
+func TestAddGroupMembers(t *testing.T) {
+	t.Parallel()
+
+	groupContents := "root:x:0:\nsudo:x:27:alice\ndocker:x:999:\n"
+	contents, errs := addGroupMembers(groupContents, []*GroupMembershipResource{
+		{GID: 27, User: "lcm"},
+		{GID: 999, User: "lcm"},
+		{GID: 999, User: "bob"},
+		{GID: 1234, User: "lcm"},
+	})
+	assert.Equal(t, "root:x:0:\nsudo:x:27:alice,lcm\ndocker:x:999:lcm,bob\n", contents)
+	assert.NoError(t, errs[0])
+	assert.NoError(t, errs[1])
+	assert.NoError(t, errs[2])
+	assert.EqualError(t, errs[3], "/etc/group did not contain group 1234")
+}
@@ -18,6 +18,17 @@ type Resource interface {
 
 // ResourceMeta is struct that should be embedded by all Resource implementers, so as to simplify the accounting side of things
 type ResourceMeta struct {
+	// Retry controls how the Resource is retried when it fails to be evaluated
+	Retry RetryPolicy
+	// Tags are arbitrary labels that can be used to select the Resource via a Selector
+	Tags []string
+	// Priority orders the Resource relative to others waiting to run when the ResourceGraph limits concurrency.
+	// Resources with a higher Priority are started first.
+	Priority int
+	// Class names the group of resources whose concurrency is limited by the ResourceGraph's ClassLimits. It defaults
+	// to the name of the Resource's type, e.g. "CmdResource".
+	Class string
+
 	name   string
 	logger *logrus.Entry
 }
@@ -37,3 +48,17 @@ func (rm *ResourceMeta) SetName(name string) {
 	rm.name = name
 	rm.logger = logrus.New().WithField("resource", name)
 }
+
+func (rm *ResourceMeta) meta() *ResourceMeta {
+	return rm
+}
+
+// metaOf returns the ResourceMeta embedded in the Resource, or an empty ResourceMeta if the Resource does not embed one
+func metaOf(r Resource) *ResourceMeta {
+	if m, ok := r.(interface{ meta() *ResourceMeta }); ok {
+		if rm := m.meta(); rm != nil {
+			return rm
+		}
+	}
+	return &ResourceMeta{}
+}
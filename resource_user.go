@@ -19,6 +19,8 @@ type UserResource struct {
 	GID   uint32
 	Home  string
 	Shell string
+
+	snapshot *entrySnapshot
 }
 
 // passwdLine returns the line we would expect to see in /etc/passwd for this user
@@ -26,12 +28,22 @@ func (ur *UserResource) passwdLine() string {
 	return fmt.Sprintf("%s:x:%d:%d::%s:%s", ur.User, ur.UID, ur.GID, ur.Home, ur.Shell)
 }
 
+// lineDefinesUID returns true if the /etc/passwd line is the entry for the UID. The UID is the third field, the GID the
+// fourth.
 func lineDefinesUID(line string, uid uint32) bool {
 	parts := strings.Split(line, ":")
 	if len(parts) != 7 {
 		return false
 	}
-	return parts[3] == strconv.Itoa(int(uid))
+	return parts[2] == strconv.Itoa(int(uid))
+}
+
+// passwdFields names the fields of an /etc/passwd entry
+var passwdFields = []string{"user", "password", "uid", "gid", "gecos", "home", "shell"}
+
+// LockKeys ensures that no other resource rewrites /etc/passwd while the user is being created
+func (ur *UserResource) LockKeys() []string {
+	return []string{"/etc/passwd"}
 }
 
 // ShouldSkip tests that the user exists, and has the correct properties. If it does, the resource is already materialized and will not be rerun
@@ -40,16 +52,21 @@ func (ur *UserResource) ShouldSkip(context.Context) (bool, error) {
 	if err != nil {
 		return false, errors.Wrap(err, "could not read /etc/passwd")
 	}
+	return ur.passwdHasUser(string(passwdContents)), nil
+}
+
+// passwdHasUser returns true if the /etc/passwd contents already contain the expected entry for the user
+func (ur *UserResource) passwdHasUser(passwdContents string) bool {
 	expectedLine := ur.passwdLine()
-	for _, line := range strings.Split(string(passwdContents), "\n") {
+	for _, line := range strings.Split(passwdContents, "\n") {
 		if line == expectedLine {
-			return true, nil
+			return true
 		} else if lineDefinesUID(line, ur.UID) {
-			ur.Logger().Infof("found user registered with different attributes")
-			return false, nil
+			ur.Logger().Infof("found user registered with different attributes: %s", line)
+			return false
 		}
 	}
-	return false, nil
+	return false
 }
 
 // Materialize creates the user
@@ -58,25 +75,109 @@ func (ur *UserResource) Materialize(context.Context) error {
 	if err != nil {
 		return errors.Wrap(err, "could not read /etc/passwd")
 	}
+	err = ioutil.WriteFile("/etc/passwd", []byte(ur.materializePasswd(string(passwdContents))), 0644)
+	if err != nil {
+		return errors.Wrap(err, "failed to write to /etc/passwd")
+	}
+	return nil
+}
+
+// materializePasswd returns the /etc/passwd contents with the entry for the user's UID replaced by the expected one
+func (ur *UserResource) materializePasswd(passwdContents string) string {
 	expectedLine := ur.passwdLine()
 	newPasswd := bytes.NewBuffer(nil)
-	for _, line := range strings.Split(string(passwdContents), "\n") {
+	for _, line := range strings.Split(passwdContents, "\n") {
 		if len(line) == 0 {
 			continue
 		}
 		if line == expectedLine {
 			ur.Logger().Warnf("skip failed, user existed")
 		} else if lineDefinesUID(line, ur.UID) {
-			newPasswd.Write([]byte(expectedLine))
-		} else {
-			newPasswd.Write([]byte(line))
+			line = expectedLine
 		}
-		newPasswd.Write([]byte{'\n'})
+		newPasswd.WriteString(line)
+		newPasswd.WriteByte('\n')
 	}
+	return newPasswd.String()
+}
+
+// Snapshot records the user's current /etc/passwd entry, so that it can be restored by Revert
+func (ur *UserResource) Snapshot(context.Context) error {
+	passwdContents, err := ioutil.ReadFile("/etc/passwd")
+	if err != nil {
+		return errors.Wrap(err, "could not read /etc/passwd")
+	}
+	ur.snapshot = ur.snapshotPasswd(string(passwdContents))
+	return nil
+}
+
+func (ur *UserResource) snapshotPasswd(passwdContents string) *entrySnapshot {
+	for _, line := range strings.Split(passwdContents, "\n") {
+		if lineDefinesUID(line, ur.UID) {
+			return &entrySnapshot{entry: line, existed: true}
+		}
+	}
+	return &entrySnapshot{}
+}
 
-	err = ioutil.WriteFile("/etc/passwd", newPasswd.Bytes(), 0644)
+// Revert restores the user's /etc/passwd entry to the one recorded by Snapshot. If there was no entry, it is removed.
+// The rest of /etc/passwd is left as it is.
+func (ur *UserResource) Revert(context.Context) error {
+	if ur.snapshot == nil {
+		return errors.Errorf("no snapshot of user %v to revert to", ur.User)
+	}
+	passwdContents, err := ioutil.ReadFile("/etc/passwd")
+	if err != nil {
+		return errors.Wrap(err, "could not read /etc/passwd")
+	}
+	err = ioutil.WriteFile("/etc/passwd", []byte(ur.revertPasswd(string(passwdContents))), 0644)
 	if err != nil {
 		return errors.Wrap(err, "failed to write to /etc/passwd")
 	}
 	return nil
 }
+
+func (ur *UserResource) revertPasswd(passwdContents string) string {
+	newPasswd := bytes.NewBuffer(nil)
+	for _, line := range strings.Split(passwdContents, "\n") {
+		if len(line) == 0 {
+			continue
+		}
+		if lineDefinesUID(line, ur.UID) {
+			if !ur.snapshot.existed {
+				continue
+			}
+			line = ur.snapshot.entry
+		}
+		newPasswd.WriteString(line)
+		newPasswd.WriteByte('\n')
+	}
+	return newPasswd.String()
+}
+
+// Diff describes the changes to the user's /etc/passwd entry that Materialize would make
+func (ur *UserResource) Diff(context.Context) (*Diff, error) {
+	passwdContents, err := ioutil.ReadFile("/etc/passwd")
+	if err != nil {
+		return nil, errors.Wrap(err, "could not read /etc/passwd")
+	}
+	return ur.diffPasswd(string(passwdContents)), nil
+}
+
+func (ur *UserResource) diffPasswd(passwdContents string) *Diff {
+	desired := strings.Split(ur.passwdLine(), ":")
+	for _, line := range strings.Split(passwdContents, "\n") {
+		if !lineDefinesUID(line, ur.UID) {
+			continue
+		}
+		current := strings.Split(line, ":")
+		diff := &Diff{}
+		for i, field := range passwdFields {
+			if current[i] != desired[i] {
+				diff.Fields = append(diff.Fields, FieldDiff{Field: field, Current: current[i], Desired: desired[i]})
+			}
+		}
+		return diff
+	}
+	return &Diff{Missing: true}
+}
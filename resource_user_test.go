@@ -1,3 +1,27 @@
 package rfsb
 
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
 var _ Resource = &UserResource{}
+
+func TestUserResourceMatchesUID(t *testing.T) {
+	t.Parallel()
+
+	// bob's GID is lcm's UID, so only the UID distinguishes their entries
+	passwd := "root:x:0:0::/root:/bin/bash\nbob:x:1001:1000::/home/bob:/bin/sh\nlcm:x:1000:1000::/home/lcm:/bin/sh\n"
+	ur := &UserResource{User: "lcm", UID: 1000, GID: 1000, Home: "/home/lcm", Shell: "/bin/bash"}
+	ur.SetName("lcm")
+
+	assert.False(t, ur.passwdHasUser(passwd))
+	assert.Equal(t,
+		"root:x:0:0::/root:/bin/bash\nbob:x:1001:1000::/home/bob:/bin/sh\nlcm:x:1000:1000::/home/lcm:/bin/bash\n",
+		ur.materializePasswd(passwd))
+	assert.True(t, ur.passwdHasUser(ur.materializePasswd(passwd)))
+
+	assert.True(t, lineDefinesUID("lcm:x:1000:1000::/home/lcm:/bin/sh", 1000))
+	assert.False(t, lineDefinesUID("bob:x:1001:1000::/home/bob:/bin/sh", 1000))
+}
@@ -0,0 +1,115 @@
+package rfsb
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// RetryPolicy controls how ResourceGraph retries a Resource that fails to be evaluated. The zero value runs each
+// Resource once, with no timeout.
+//
+// It is set via the Retry field of ResourceMeta:
+//
+//    startMongo := &systemd.StartUnit{UnitName: "mongodb.service"}
+//    startMongo.Retry = rfsb.RetryPolicy{
+//        Timeout:        time.Minute,
+//        MaxAttempts:    5,
+//        InitialBackoff: time.Second,
+//        MaxBackoff:     30 * time.Second,
+//        Jitter:         0.5,
+//    }
+type RetryPolicy struct {
+	// Timeout bounds each attempt, covering both ShouldSkip and Materialize. Zero means no timeout.
+	Timeout time.Duration
+	// MaxAttempts is the maximum number of times the Resource will be evaluated. Zero is treated as one.
+	MaxAttempts int
+	// InitialBackoff is the delay before the first retry. The delay doubles after each subsequent attempt.
+	InitialBackoff time.Duration
+	// MaxBackoff caps the delay between attempts. Zero means no cap.
+	MaxBackoff time.Duration
+	// Jitter is the fraction, between 0 and 1, of each delay that is randomized. This prevents a fleet of hosts from
+	// retrying in lockstep.
+	Jitter float64
+}
+
+func (rp RetryPolicy) attempts() int {
+	if rp.MaxAttempts < 1 {
+		return 1
+	}
+	return rp.MaxAttempts
+}
+
+// backoff returns the delay to wait after the given (1 indexed) attempt
+func (rp RetryPolicy) backoff(attempt int) time.Duration {
+	limit := rp.MaxBackoff
+	if limit == 0 {
+		limit = math.MaxInt64
+	}
+	delay := rp.InitialBackoff
+	for i := 1; i < attempt && delay < limit; i++ {
+		// Clamp before doubling, so that the delay can not overflow
+		if delay > limit/2 {
+			delay = limit
+			break
+		}
+		delay *= 2
+	}
+	if delay > limit {
+		delay = limit
+	}
+	if rp.Jitter > 0 {
+		delay -= time.Duration(rand.Float64() * rp.Jitter * float64(delay))
+	}
+	return delay
+}
+
+// evaluateWithRetry evaluates the resource, retrying according to the resource's RetryPolicy. Locks are held for each
+// attempt, but released while backing off. The custom signals emitted by the final attempt are returned.
+func (e *execution) evaluateWithRetry(ctx context.Context, resource Resource) (Signal, []Signal, error) {
+	policy := metaOf(resource).Retry
+	for attempt := 1; ; attempt++ {
+		if policy.attempts() > 1 {
+			resource.Logger().Infof("starting attempt %d of %d", attempt, policy.attempts())
+		}
+		sig, signals, err := e.attempt(ctx, resource, policy.Timeout)
+		if err == nil || attempt >= policy.attempts() || ctx.Err() != nil {
+			return sig, signals, err
+		}
+
+		delay := policy.backoff(attempt)
+		resource.Logger().Warnf("attempt %d of %d failed, retrying in %v: %v", attempt, policy.attempts(), delay, err)
+		queued := time.Now()
+		select {
+		case <-time.After(delay):
+			e.queued(resource, queued)
+		case <-ctx.Done():
+			e.queued(resource, queued)
+			return sig, nil, err
+		}
+	}
+}
+
+// attempt evaluates the resource once, returning the custom signals it emitted
+func (e *execution) attempt(ctx context.Context, resource Resource, timeout time.Duration) (Signal, []Signal, error) {
+	// Batchable resources take their slots and locks themselves, so that they are not held while waiting for the rest
+	// of the batch
+	if _, ok := resource.(Batchable); !ok || e.batches == nil {
+		free, release, err := e.acquire(ctx, resource)
+		if err != nil {
+			return Unevaluated, nil, err
+		}
+		defer free()
+		defer release()
+	}
+
+	if timeout != 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	collector := &signalCollector{}
+	sig, err := e.evaluate(context.WithValue(ctx, signalCollectorKey{}, collector), resource)
+	return sig, collector.collected(), err
+}
@@ -0,0 +1,93 @@
+package rfsb
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// flakyResource fails the first failures times it is materialized
+type flakyResource struct {
+	ResourceMeta
+	failures int
+	attempts int
+}
+
+func (fr *flakyResource) Materialize(context.Context) error {
+	fr.attempts++
+	if fr.attempts <= fr.failures {
+		return errors.New("transient failure")
+	}
+	return nil
+}
+
+// hangingResource blocks until its context is cancelled
+type hangingResource struct {
+	ResourceMeta
+}
+
+func (*hangingResource) Materialize(ctx context.Context) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	t.Parallel()
+
+	policy := RetryPolicy{InitialBackoff: time.Second, MaxBackoff: 5 * time.Second}
+	assert.Equal(t, time.Second, policy.backoff(1))
+	assert.Equal(t, 2*time.Second, policy.backoff(2))
+	assert.Equal(t, 4*time.Second, policy.backoff(3))
+	assert.Equal(t, 5*time.Second, policy.backoff(4))
+	assert.Equal(t, 5*time.Second, policy.backoff(100))
+
+	uncapped := RetryPolicy{InitialBackoff: time.Second}
+	assert.Equal(t, (1<<33)*time.Second, uncapped.backoff(34))
+	for _, attempt := range []int{35, 64, 1000} {
+		assert.Equal(t, time.Duration(math.MaxInt64), uncapped.backoff(attempt), "attempt %d", attempt)
+	}
+
+	policy.Jitter = 0.5
+	for i := 0; i < 10; i++ {
+		delay := policy.backoff(1)
+		assert.True(t, delay > time.Second/2 && delay <= time.Second, "delay %v out of range", delay)
+	}
+}
+
+func TestRetryPolicyRetries(t *testing.T) {
+	t.Parallel()
+
+	rg := &ResourceGraph{}
+	recovers := &flakyResource{failures: 2}
+	recovers.Retry = RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}
+	rg.Register("recovers", recovers)
+
+	require.NoError(t, rg.Materialize(context.Background()))
+	assert.Equal(t, 3, recovers.attempts)
+
+	rg = &ResourceGraph{}
+	fails := &flakyResource{failures: 2}
+	fails.Retry = RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond}
+	rg.Register("fails", fails)
+
+	assert.Error(t, rg.Materialize(context.Background()))
+	assert.Equal(t, 2, fails.attempts)
+}
+
+func TestRetryPolicyTimeout(t *testing.T) {
+	t.Parallel()
+
+	rg := &ResourceGraph{}
+	hangs := &hangingResource{}
+	hangs.Retry = RetryPolicy{Timeout: time.Millisecond}
+	rg.Register("hangs", hangs)
+
+	err := rg.Materialize(context.Background())
+	require.Error(t, err)
+	assert.Equal(t, context.DeadlineExceeded, errors.Cause(err))
+}
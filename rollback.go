@@ -0,0 +1,73 @@
+package rfsb
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// Reversible should be implemented by resources that can undo the changes made by Materialize. When a ResourceGraph
+// is Transactional, Snapshot is called immediately before the Resource is first materialized, and should capture
+// whatever state Materialize is about to change. If the run fails, Revert is called to restore that state.
+type Reversible interface {
+	Resource
+	Snapshot(context.Context) error
+	Revert(context.Context) error
+}
+
+// entrySnapshot is the state of an entry in a file such as /etc/passwd, before it was materialized
+type entrySnapshot struct {
+	entry   string
+	existed bool
+}
+
+// snapshot calls the resource's Snapshot method, if it is Reversible and has not already been snapshotted during this
+// run (i.e. by a previous attempt)
+func (e *execution) snapshot(ctx context.Context, resource Resource) error {
+	reversible, ok := resource.(Reversible)
+	if !ok {
+		return nil
+	}
+	e.snapshotsLock.Lock()
+	snapshotted := containsResource(e.snapshotted, resource)
+	e.snapshotsLock.Unlock()
+	if snapshotted {
+		return nil
+	}
+
+	if err := reversible.Snapshot(ctx); err != nil {
+		return errors.Wrapf(err, "could not snapshot %v", resource.Name())
+	}
+	e.snapshotsLock.Lock()
+	defer e.snapshotsLock.Unlock()
+	e.snapshotted = append(e.snapshotted, resource)
+	return nil
+}
+
+// rollbackTimeout bounds how long a rollback may take
+const rollbackTimeout = 5 * time.Minute
+
+// rollback reverts every snapshotted resource, in the reverse of the order they were materialized. As a resource is
+// only materialized once its dependencies have been, this never reverts a resource before its dependents.
+//
+// The run may have failed because its context was cancelled, such as when the connection to the host was lost, so the
+// resources are reverted with a fresh context, bounded by rollbackTimeout.
+func (e *execution) rollback() {
+	ctx, cancel := context.WithTimeout(context.Background(), rollbackTimeout)
+	defer cancel()
+	logrus.Warnf("reverting %d resources", len(e.snapshotted))
+	for i := len(e.snapshotted) - 1; i >= 0; i-- {
+		resource := e.snapshotted[i]
+		record := e.records[resource]
+		resource.Logger().Infof("reverting resource")
+		if err := resource.(Reversible).Revert(ctx); err != nil {
+			resource.Logger().Errorf("could not revert resource: %v", err)
+			record.RevertError = err.Error()
+			continue
+		}
+		record.Reverted = true
+	}
+	e.rolledBack = true
+}
@@ -0,0 +1,165 @@
+package rfsb
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	_ Reversible = &FileResource{}
+	_ Reversible = &UserResource{}
+	_ Reversible = &GroupResource{}
+)
+
+// reversibleResource records the order in which resources are reverted
+type reversibleResource struct {
+	testResource
+	reverted *[]string
+	lock     *sync.Mutex
+}
+
+func (rr *reversibleResource) Snapshot(context.Context) error {
+	return nil
+}
+
+func (rr *reversibleResource) Revert(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	rr.lock.Lock()
+	defer rr.lock.Unlock()
+	*rr.reverted = append(*rr.reverted, rr.Name())
+	return nil
+}
+
+func TestTransactionalRollback(t *testing.T) {
+	t.Parallel()
+
+	reverted := []string{}
+	lock := &sync.Mutex{}
+	mkReversible := func() *reversibleResource {
+		return &reversibleResource{reverted: &reverted, lock: lock}
+	}
+
+	rg := &ResourceGraph{Transactional: true, KeepGoing: true}
+	first := mkReversible()
+	rg.Register("first", first)
+	second := mkReversible()
+	rg.When(first).Do("second", second)
+	skipped := mkReversible()
+	skipped.skip = true
+	rg.Register("skipped", skipped)
+	irreversible := &testResource{}
+	rg.Register("irreversible", irreversible)
+	fails := &testResource{err: errors.New("failed")}
+	rg.When(second).Do("fails", fails)
+
+	report, err := rg.MaterializeWithReport(context.Background())
+	require.Error(t, err)
+	assert.Equal(t, []string{"second", "first"}, reverted)
+	assert.True(t, report.Resources[0].Reverted)
+	assert.True(t, report.Resources[1].Reverted)
+	assert.False(t, report.Resources[2].Reverted)
+	assert.False(t, report.Resources[3].Reverted)
+}
+
+// cancellingResource cancels the run it is part of, as if the caller had given up on it
+type cancellingResource struct {
+	ResourceMeta
+	cancel context.CancelFunc
+}
+
+func (cr *cancellingResource) Materialize(ctx context.Context) error {
+	cr.cancel()
+	return ctx.Err()
+}
+
+func TestTransactionalRollbackAfterCancel(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	reverted := []string{}
+	rg := &ResourceGraph{Transactional: true}
+	first := &reversibleResource{reverted: &reverted, lock: &sync.Mutex{}}
+	rg.Register("first", first)
+	rg.When(first).Do("cancels", &cancellingResource{cancel: cancel})
+
+	report, err := rg.MaterializeWithReport(ctx)
+	require.Error(t, err)
+	assert.Equal(t, []string{"first"}, reverted)
+	assert.True(t, report.Resources[0].Reverted)
+	assert.Empty(t, report.Resources[0].RevertError)
+}
+
+func TestTransactionalNoRollbackOnSuccess(t *testing.T) {
+	t.Parallel()
+
+	reverted := []string{}
+	rg := &ResourceGraph{Transactional: true}
+	rg.Register("resource", &reversibleResource{reverted: &reverted, lock: &sync.Mutex{}})
+	require.NoError(t, rg.Materialize(context.Background()))
+	assert.Empty(t, reverted)
+}
+
+func TestFileResourceRevert(t *testing.T) {
+	t.Parallel()
+
+	scratchDir, err := ioutil.TempDir("", t.Name())
+	require.NoError(t, err)
+	defer os.RemoveAll(scratchDir)
+
+	existing := &FileResource{
+		Path:     scratchDir + "/existing",
+		Contents: "new",
+		Mode:     0600,
+		UID:      uint32(os.Getuid()),
+		GID:      uint32(os.Getgid()),
+	}
+	require.NoError(t, ioutil.WriteFile(existing.Path, []byte("old"), 0644))
+	require.NoError(t, existing.Snapshot(context.Background()))
+	require.NoError(t, existing.Materialize(context.Background()))
+	require.NoError(t, existing.Revert(context.Background()))
+	contents, err := ioutil.ReadFile(existing.Path)
+	require.NoError(t, err)
+	assert.Equal(t, "old", string(contents))
+	fi, err := os.Stat(existing.Path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0644), fi.Mode())
+
+	created := &FileResource{
+		Path:     scratchDir + "/created",
+		Contents: "new",
+		Mode:     0644,
+		UID:      uint32(os.Getuid()),
+		GID:      uint32(os.Getgid()),
+	}
+	require.NoError(t, created.Snapshot(context.Background()))
+	require.NoError(t, created.Materialize(context.Background()))
+	require.NoError(t, created.Revert(context.Background()))
+	_, err = os.Stat(created.Path)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestUserAndGroupRevert(t *testing.T) {
+	t.Parallel()
+
+	ur := &UserResource{User: "lcm", UID: 1000, GID: 1000, Home: "/home/lcm", Shell: "/bin/bash"}
+	before := "root:x:0:0::/root:/bin/sh\nlcm:x:1000:1000::/home/lcm:/bin/sh\n"
+	ur.snapshot = ur.snapshotPasswd(before)
+	after := "root:x:0:0::/root:/bin/sh\nlcm:x:1000:1000::/home/lcm:/bin/bash\n"
+	assert.Equal(t, before, ur.revertPasswd(after))
+	ur.snapshot = ur.snapshotPasswd("root:x:0:0::/root:/bin/sh\n")
+	assert.Equal(t, "root:x:0:0::/root:/bin/sh\n", ur.revertPasswd(after))
+
+	gr := &GroupResource{Group: "admins", GID: 1000}
+	gr.snapshot = gr.snapshotGroup("root:x:0:\nlcm:x:1000:\n")
+	assert.Equal(t, "root:x:0:\nlcm:x:1000:lcm\n", gr.revertGroup("root:x:0:\nadmins:x:1000:lcm\n"))
+}
@@ -0,0 +1,163 @@
+package rfsb
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"sync"
+)
+
+// classOf returns the concurrency class of the resource: its Class if set, or else the name of its type
+func classOf(r Resource) string {
+	if class := metaOf(r).Class; class != "" {
+		return class
+	}
+	t := reflect.TypeOf(r)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Name()
+}
+
+// chainLengths returns, for each resource, the number of resources on the longest chain of dependents starting with
+// it. Resources at the start of long chains should be started first, as everything after them is waiting on them.
+func (rg *ResourceGraph) chainLengths() map[Resource]int {
+	lengths := make(map[Resource]int, len(rg.resources))
+	var length func(r Resource) int
+	length = func(r Resource) int {
+		if l, ok := lengths[r]; ok {
+			return l
+		}
+		longest := 0
+		for to := range rg.dependencies[r] {
+			if l := length(to); l > longest {
+				longest = l
+			}
+		}
+		lengths[r] = longest + 1
+		return longest + 1
+	}
+	for _, r := range rg.resources {
+		length(r)
+	}
+	return lengths
+}
+
+// slotRequest is a resource waiting for the scheduler to let it run
+type slotRequest struct {
+	resource Resource
+	class    string
+	granted  chan struct{}
+}
+
+// scheduler bounds how many resources are evaluated at once, both overall and per class. When resources are waiting,
+// they are started in order of their Priority, then the length of the chain of dependents waiting on them, and then
+// their registration order.
+type scheduler struct {
+	limit       int
+	classLimits map[string]int
+	rank        map[Resource]int
+
+	lock           sync.Mutex
+	running        int
+	runningByClass map[string]int
+	// waiting holds the requests that have not yet been granted, ordered by rank
+	waiting []*slotRequest
+}
+
+// newScheduler returns a scheduler for the ResourceGraph, or nil if it does not limit concurrency
+func newScheduler(rg *ResourceGraph) *scheduler {
+	if rg.MaxConcurrency <= 0 && len(rg.ClassLimits) == 0 {
+		return nil
+	}
+	lengths := rg.chainLengths()
+	order := append([]Resource{}, rg.resources...)
+	sort.SliceStable(order, func(i, j int) bool {
+		pi, pj := metaOf(order[i]).Priority, metaOf(order[j]).Priority
+		if pi != pj {
+			return pi > pj
+		}
+		return lengths[order[i]] > lengths[order[j]]
+	})
+	rank := make(map[Resource]int, len(order))
+	for i, r := range order {
+		rank[r] = i
+	}
+	return &scheduler{
+		limit:          rg.MaxConcurrency,
+		classLimits:    rg.ClassLimits,
+		rank:           rank,
+		runningByClass: map[string]int{},
+	}
+}
+
+// acquire blocks until the resource may run, returning a function that must be called once it has finished, and
+// whether it had to wait
+func (s *scheduler) acquire(ctx context.Context, r Resource) (func(), bool, error) {
+	if s == nil {
+		return func() {}, false, nil
+	}
+	req := &slotRequest{resource: r, class: classOf(r), granted: make(chan struct{})}
+	s.lock.Lock()
+	i := sort.Search(len(s.waiting), func(i int) bool { return s.rank[s.waiting[i].resource] > s.rank[r] })
+	s.waiting = append(s.waiting, nil)
+	copy(s.waiting[i+1:], s.waiting[i:])
+	s.waiting[i] = req
+	s.dispatch()
+	s.lock.Unlock()
+
+	free := func() {
+		s.lock.Lock()
+		defer s.lock.Unlock()
+		s.free(req)
+	}
+	select {
+	case <-req.granted:
+		return free, false, nil
+	default:
+	}
+	select {
+	case <-req.granted:
+		return free, true, nil
+	case <-ctx.Done():
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for i, waiting := range s.waiting {
+		if waiting == req {
+			s.waiting = append(s.waiting[:i], s.waiting[i+1:]...)
+			return nil, true, ctx.Err()
+		}
+	}
+	// The request was granted as the context was cancelled
+	s.free(req)
+	return nil, true, ctx.Err()
+}
+
+// free releases the slot held by the granted request. It must be called with the lock held.
+func (s *scheduler) free(req *slotRequest) {
+	s.running--
+	s.runningByClass[req.class]--
+	s.dispatch()
+}
+
+// dispatch grants as many waiting requests as the limits allow, in order of rank. Requests whose class is at its limit
+// are passed over in favour of lower ranked requests of other classes. It must be called with the lock held.
+func (s *scheduler) dispatch() {
+	waiting := s.waiting[:0]
+	for _, req := range s.waiting {
+		if s.limit > 0 && s.running >= s.limit {
+			waiting = append(waiting, req)
+			continue
+		}
+		if limit := s.classLimits[req.class]; limit > 0 && s.runningByClass[req.class] >= limit {
+			waiting = append(waiting, req)
+			continue
+		}
+		s.running++
+		s.runningByClass[req.class]++
+		close(req.granted)
+	}
+	s.waiting = waiting
+}
@@ -0,0 +1,147 @@
+package rfsb
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// concurrencyCounter tracks how many resources are being materialized at once
+type concurrencyCounter struct {
+	current, max int32
+}
+
+// countingResource is materialized for a short time, recording the peak concurrency of its counters
+type countingResource struct {
+	ResourceMeta
+	counters []*concurrencyCounter
+}
+
+func (cr *countingResource) Materialize(context.Context) error {
+	for _, counter := range cr.counters {
+		current := atomic.AddInt32(&counter.current, 1)
+		for {
+			max := atomic.LoadInt32(&counter.max)
+			if current <= max || atomic.CompareAndSwapInt32(&counter.max, max, current) {
+				break
+			}
+		}
+	}
+	time.Sleep(5 * time.Millisecond)
+	for _, counter := range cr.counters {
+		atomic.AddInt32(&counter.current, -1)
+	}
+	return nil
+}
+
+func TestResourceGraphConcurrencyLimits(t *testing.T) {
+	t.Parallel()
+
+	all := &concurrencyCounter{}
+	downloads := &concurrencyCounter{}
+	rg := &ResourceGraph{MaxConcurrency: 3, ClassLimits: map[string]int{"download": 1}}
+	for i := 0; i < 10; i++ {
+		r := &countingResource{counters: []*concurrencyCounter{all}}
+		rg.Register(fmt.Sprintf("resource%d", i), r)
+		download := &countingResource{counters: []*concurrencyCounter{all, downloads}}
+		download.Class = "download"
+		rg.Register(fmt.Sprintf("download%d", i), download)
+	}
+
+	require.NoError(t, rg.Materialize(context.Background()))
+	assert.True(t, all.max <= 3, "at most 3 resources should run at once, not %d", all.max)
+	assert.Equal(t, int32(1), downloads.max)
+}
+
+func TestResourceGraphConcurrencyLimitIsQueued(t *testing.T) {
+	t.Parallel()
+
+	rg := &ResourceGraph{MaxConcurrency: 1}
+	for i := 0; i < 3; i++ {
+		rg.Register(fmt.Sprintf("resource%d", i), &sleepingResource{duration: 10 * time.Millisecond})
+	}
+
+	report, err := rg.MaterializeWithReport(context.Background())
+	require.NoError(t, err)
+	assert.True(t, report.Finished.Sub(report.Started) >= 30*time.Millisecond)
+	for _, resource := range report.Resources {
+		// Waiting for a slot happens before the resource starts, and is not counted as work
+		for _, span := range resource.Queued {
+			assert.False(t, span.End.After(resource.Started))
+		}
+		assert.Equal(t, resource.Finished.Sub(resource.Started), resource.Duration())
+	}
+}
+
+func TestSchedulerPriority(t *testing.T) {
+	t.Parallel()
+
+	rg := &ResourceGraph{MaxConcurrency: 1}
+	holder := &testResource{}
+	rg.Register("holder", holder)
+	first := &testResource{}
+	rg.Register("first", first)
+	short := &testResource{}
+	rg.Register("short", short)
+	long := &testResource{}
+	rg.Register("long", long)
+	rg.When(long).Do("afterLong", &testResource{})
+	urgent := &testResource{}
+	urgent.Priority = 1
+	rg.Register("urgent", urgent)
+
+	s := newScheduler(rg)
+	assert.Equal(t, "testResource", classOf(holder))
+	free, queued, err := s.acquire(context.Background(), holder)
+	require.NoError(t, err)
+	assert.False(t, queued)
+
+	lock := sync.Mutex{}
+	order := []string{}
+	grp := sync.WaitGroup{}
+	for _, r := range []Resource{short, first, long, urgent} {
+		r := r
+		grp.Add(1)
+		go func() {
+			defer grp.Done()
+			free, queued, err := s.acquire(context.Background(), r)
+			assert.True(t, queued)
+			if !assert.NoError(t, err) {
+				return
+			}
+			lock.Lock()
+			order = append(order, r.Name())
+			lock.Unlock()
+			free()
+		}()
+	}
+	for {
+		s.lock.Lock()
+		waiting := len(s.waiting)
+		s.lock.Unlock()
+		if waiting == 4 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	free()
+	grp.Wait()
+	assert.Equal(t, []string{"urgent", "long", "first", "short"}, order)
+
+	// A cancelled request gives up its place
+	free, _, err = s.acquire(context.Background(), holder)
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, _, err = s.acquire(ctx, urgent)
+	assert.Equal(t, context.Canceled, err)
+	free()
+	assert.Empty(t, s.waiting)
+	assert.Equal(t, 0, s.running)
+}
@@ -0,0 +1,73 @@
+package rfsb
+
+import (
+	"path"
+)
+
+// Selector chooses a subset of a ResourceGraph to materialize. A Resource is matched if its hierarchical name matches
+// any of the Names patterns, or if it has any of the Tags. Patterns use the syntax of path.Match, where * matches any
+// sequence of characters, including the · that separates the levels of the hierarchy. For example, "users·*" matches
+// every resource registered via the users graph.
+//
+// When a ResourceGraph has a Selector, only the matched resources and the resources they depend on (directly or
+// indirectly) are evaluated. Every other resource is reported as not selected.
+type Selector struct {
+	Names []string
+	Tags  []string
+}
+
+// Matches returns true if the Resource is matched by the Selector
+func (s *Selector) Matches(r Resource) bool {
+	for _, pattern := range s.Names {
+		if matched, _ := path.Match(pattern, r.Name()); matched {
+			return true
+		}
+	}
+	for _, tag := range metaOf(r).Tags {
+		for _, wanted := range s.Tags {
+			if tag == wanted {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// selectedResources returns the resources that should be evaluated, in registration order. If the graph has no
+// Selector, this is every resource.
+func (rg *ResourceGraph) selectedResources() []Resource {
+	if rg.Selector == nil {
+		return rg.resources
+	}
+
+	selected := map[Resource]struct{}{}
+	var selectWithDependencies func(r Resource)
+	selectWithDependencies = func(r Resource) {
+		if _, ok := selected[r]; ok {
+			return
+		}
+		selected[r] = struct{}{}
+		for from := range rg.inverseDependencies[r] {
+			selectWithDependencies(from)
+		}
+	}
+	for _, r := range rg.resources {
+		if rg.Selector.Matches(r) {
+			selectWithDependencies(r)
+		}
+		// A resource stands in for those merged into it, so is selected by their names and Tags too
+		for _, merged := range rg.merged[r] {
+			if rg.Selector.Matches(merged) {
+				selectWithDependencies(r)
+			}
+		}
+	}
+
+	resources := []Resource{}
+	for _, r := range rg.resources {
+		if _, ok := selected[r]; ok {
+			resources = append(resources, r)
+		}
+	}
+	return resources
+}
@@ -0,0 +1,65 @@
+package rfsb
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSelectorMatches(t *testing.T) {
+	t.Parallel()
+
+	r := &testResource{}
+	r.SetName("users·lcm·sshKey")
+	r.Tags = []string{"ssh"}
+
+	assert.True(t, (&Selector{Names: []string{"users·*"}}).Matches(r))
+	assert.True(t, (&Selector{Names: []string{"*·sshKey"}}).Matches(r))
+	assert.False(t, (&Selector{Names: []string{"mongo·*"}}).Matches(r))
+	assert.True(t, (&Selector{Tags: []string{"sudo", "ssh"}}).Matches(r))
+	assert.False(t, (&Selector{Tags: []string{"sudo"}}).Matches(r))
+}
+
+func TestSelectorRestrictsMaterialize(t *testing.T) {
+	t.Parallel()
+
+	users := &ResourceGraph{}
+	group := &testResource{}
+	user := &testResource{}
+	users.Register("group", group)
+	users.When(group).Do("user", user)
+
+	mongo := &ResourceGraph{}
+	service := &testResource{}
+	mongo.Register("service", service)
+	tagged := &testResource{}
+	tagged.Tags = []string{"restart"}
+	mongo.When(service).Do("restart", tagged)
+
+	rg := &ResourceGraph{Selector: &Selector{Names: []string{"users·user"}}}
+	rg.Register("users", users)
+	rg.Register("mongo", mongo)
+
+	report, err := rg.MaterializeWithReport(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), group.materialized)
+	assert.Equal(t, int32(1), user.materialized)
+	assert.Equal(t, int32(0), service.materialized)
+	assert.Equal(t, int32(0), tagged.materialized)
+	assert.False(t, report.Resources[0].NotSelected)
+	assert.False(t, report.Resources[1].NotSelected)
+	assert.True(t, report.Resources[2].NotSelected)
+	assert.True(t, report.Resources[3].NotSelected)
+
+	rg.Selector = &Selector{Tags: []string{"restart"}}
+	rg.Serial = true
+	plan, err := rg.Plan(context.Background())
+	require.NoError(t, err)
+	actions := []PlanAction{}
+	for _, entry := range plan.Entries {
+		actions = append(actions, entry.Action)
+	}
+	assert.Equal(t, []PlanAction{PlanNotSelected, PlanNotSelected, PlanMaterialize, PlanMaterialize}, actions)
+}
@@ -0,0 +1,91 @@
+package rfsb
+
+import (
+	"context"
+	"math/rand"
+	"sort"
+)
+
+// serialOrder returns the resources in a topological order. Resources that are ready at the same time are ordered
+// using a permutation seeded by the passed seed. The permutation is applied to the resources sorted by name, so the
+// order does not depend on registration order, which may itself be non-deterministic (i.e. when ranging over a map).
+func (rg *ResourceGraph) serialOrder(seed int64) []Resource {
+	byName := append([]Resource{}, rg.resources...)
+	sort.SliceStable(byName, func(i, j int) bool { return byName[i].Name() < byName[j].Name() })
+	rank := make(map[Resource]int, len(byName))
+	for i, p := range rand.New(rand.NewSource(seed)).Perm(len(byName)) {
+		rank[byName[i]] = p
+	}
+
+	index := rg.resourceIndex()
+	waitingOn := make(map[Resource]int, len(rg.resources))
+	for _, r := range rg.resources {
+		for from := range rg.inverseDependencies[r] {
+			if _, ok := index[from]; ok {
+				waitingOn[r]++
+			}
+		}
+	}
+	ready := []Resource{}
+	for _, r := range rg.resources {
+		if waitingOn[r] == 0 {
+			ready = append(ready, r)
+		}
+	}
+
+	order := make([]Resource, 0, len(rg.resources))
+	for len(ready) != 0 {
+		sort.Slice(ready, func(i, j int) bool { return rank[ready[i]] < rank[ready[j]] })
+		next := ready[0]
+		ready = ready[1:]
+		order = append(order, next)
+		for _, to := range rg.sortedDependents(index, next) {
+			waitingOn[to]--
+			if waitingOn[to] == 0 {
+				ready = append(ready, to)
+			}
+		}
+	}
+	return order
+}
+
+// sequencer ensures that resources are evaluated one at a time, in a fixed order
+type sequencer struct {
+	turns    []chan struct{}
+	position map[Resource]int
+}
+
+func newSequencer(order []Resource) *sequencer {
+	seq := &sequencer{
+		turns:    make([]chan struct{}, len(order)+1),
+		position: make(map[Resource]int, len(order)),
+	}
+	for i, r := range order {
+		seq.turns[i] = make(chan struct{})
+		seq.position[r] = i
+	}
+	seq.turns[len(order)] = make(chan struct{})
+	close(seq.turns[0])
+	return seq
+}
+
+// wait blocks until it is the resource's turn to be evaluated, returning whether it had to wait
+func (seq *sequencer) wait(ctx context.Context, r Resource) (bool, error) {
+	turn := seq.turns[seq.position[r]]
+	select {
+	case <-turn:
+		return false, nil
+	default:
+	}
+	select {
+	case <-turn:
+		return true, nil
+	case <-ctx.Done():
+		return true, ctx.Err()
+	}
+}
+
+// done passes the turn on to the next resource
+func (seq *sequencer) done(r Resource) {
+	close(seq.turns[seq.position[r]+1])
+}
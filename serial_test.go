@@ -0,0 +1,69 @@
+package rfsb
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// orderObserver records the order in which resources start being evaluated
+type orderObserver struct {
+	NopObserver
+	order []string
+}
+
+func (oo *orderObserver) EvaluationStarted(r Resource) {
+	oo.order = append(oo.order, r.Name())
+}
+
+func mkSerialGraph(seed int64) (*ResourceGraph, *orderObserver) {
+	observer := &orderObserver{}
+	rg := &ResourceGraph{Serial: true, SerialSeed: seed, Observers: []Observer{observer}}
+	root := &testResource{}
+	rg.Register("root", root)
+	for i := 0; i < 10; i++ {
+		rg.When(root).Do(fmt.Sprintf("child%d", i), &testResource{})
+	}
+	skipped := &testResource{skip: true}
+	rg.Register("skipped", skipped)
+	rg.When(skipped, Materialized).Do("afterSkipped", &testResource{})
+	return rg, observer
+}
+
+func TestSerialIsDeterministic(t *testing.T) {
+	t.Parallel()
+
+	rg, first := mkSerialGraph(42)
+	require.NoError(t, rg.Materialize(context.Background()))
+	rg, second := mkSerialGraph(42)
+	require.NoError(t, rg.Materialize(context.Background()))
+	assert.Equal(t, first.order, second.order)
+	// afterSkipped is never evaluated, as skipped does not emit Materialized
+	assert.Len(t, first.order, 12)
+
+	rg, other := mkSerialGraph(7)
+	require.NoError(t, rg.Materialize(context.Background()))
+	assert.NotEqual(t, first.order, other.order)
+	assert.ElementsMatch(t, first.order, other.order)
+}
+
+func TestSerialOrderIsTopological(t *testing.T) {
+	t.Parallel()
+
+	for seed := int64(0); seed < 20; seed++ {
+		rg, _ := mkSerialGraph(seed)
+		position := map[Resource]int{}
+		for i, r := range rg.serialOrder(seed) {
+			position[r] = i
+		}
+		require.Len(t, position, len(rg.resources))
+		for from, tos := range rg.dependencies {
+			for to := range tos {
+				assert.True(t, position[from] < position[to], "%s ordered after %s", from.Name(), to.Name())
+			}
+		}
+	}
+}
@@ -1,6 +1,13 @@
 package rfsb
 
-// Signal is a wrapper for a string. Define your own if you feel the need
+import (
+	"context"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Signal is a wrapper for a string. Define your own via RegisterSignal if you feel the need
 type Signal byte
 
 const (
@@ -9,6 +16,7 @@ const (
 	// 1. The resource's dependencies finished, but did not emit the signals the resource depended on.
 	// 2. The resource's dependencies were met, and the resource was skipped
 	// 3. The resource's dependencies were met, and the resource was materialized
+	// 4. The resource's dependencies were met, and the resource failed
 	Finished Signal = iota
 	// Unevaluated is emitted by ResourceGraph when a Resource's dependencies emit the Finished signal, and the resource
 	// was dependent on a different signal.
@@ -21,6 +29,10 @@ const (
 	Skipped
 	// Materialized is emitted by ResourceGraph when a Resource's Materialize function is called.
 	Materialized
+	// Failed is emitted by ResourceGraph when a Resource's ShouldSkip or Materialize function returns an error. As the
+	// first failure cancels the whole graph by default, depending on Failed is only useful when the ResourceGraph's
+	// KeepGoing option is set.
+	Failed
 )
 
 func (s Signal) String() string {
@@ -35,7 +47,105 @@ func (s Signal) String() string {
 		return "Skipped"
 	case Materialized:
 		return "Materialized"
+	case Failed:
+		return "Failed"
 	default:
+		customSignalsLock.RLock()
+		defer customSignalsLock.RUnlock()
+		if int(s-firstCustomSignal) < len(customSignals) {
+			return customSignals[s-firstCustomSignal]
+		}
 		return "UNKNOWN_SIGNAL"
 	}
 }
+
+// MarshalText encodes the signal as its name, so that signals are readable when serialized
+func (s Signal) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText decodes a signal from its name
+func (s *Signal) UnmarshalText(text []byte) error {
+	for candidate := Finished; candidate < firstCustomSignal+Signal(customSignalCount()); candidate++ {
+		if candidate.String() == string(text) {
+			*s = candidate
+			return nil
+		}
+	}
+	return errors.Errorf("unknown signal %q", text)
+}
+
+const firstCustomSignal = Failed + 1
+
+var (
+	customSignalsLock = sync.RWMutex{}
+	customSignals     = []string{}
+)
+
+func customSignalCount() int {
+	customSignalsLock.RLock()
+	defer customSignalsLock.RUnlock()
+	return len(customSignals)
+}
+
+// RegisterSignal defines a new Signal with the given name, which resources can emit via EmitSignal. Signals should be
+// registered before Materialize is called, typically when initializing a package variable:
+//
+//    var ConfigChanged = rfsb.RegisterSignal("ConfigChanged")
+//
+// RegisterSignal panics if the name is already in use, or if too many signals have been registered.
+func RegisterSignal(name string) Signal {
+	for sig := Finished; sig < firstCustomSignal; sig++ {
+		if sig.String() == name {
+			panic("rfsb: signal " + name + " is already defined")
+		}
+	}
+
+	customSignalsLock.Lock()
+	defer customSignalsLock.Unlock()
+	for _, existing := range customSignals {
+		if existing == name {
+			panic("rfsb: signal " + name + " is already defined")
+		}
+	}
+	if int(firstCustomSignal)+len(customSignals) > 255 {
+		panic("rfsb: too many signals registered")
+	}
+	customSignals = append(customSignals, name)
+	return firstCustomSignal + Signal(len(customSignals)-1)
+}
+
+type signalCollectorKey struct{}
+
+// signalCollector records the custom signals emitted by a Resource while it is being evaluated
+type signalCollector struct {
+	lock    sync.Mutex
+	signals []Signal
+}
+
+func (sc *signalCollector) collected() []Signal {
+	sc.lock.Lock()
+	defer sc.lock.Unlock()
+	return append([]Signal{}, sc.signals...)
+}
+
+// EmitSignal emits a custom signal (see RegisterSignal) for the Resource being evaluated. It must be called with the
+// context passed to the Resource's ShouldSkip or Materialize method. Dependents will receive the signal when the
+// Resource finishes being evaluated, and a signal is only delivered once, however many times it is emitted. Signals
+// are only delivered if the Resource is evaluated successfully; those emitted by a failed attempt are discarded.
+func EmitSignal(ctx context.Context, sig Signal) error {
+	if sig < firstCustomSignal || int(sig-firstCustomSignal) >= customSignalCount() {
+		return errors.Errorf("can only emit signals defined via RegisterSignal, not %v", sig)
+	}
+	collector, ok := ctx.Value(signalCollectorKey{}).(*signalCollector)
+	if !ok {
+		return errors.New("context does not belong to a Resource being evaluated")
+	}
+
+	collector.lock.Lock()
+	defer collector.lock.Unlock()
+	if !containsSignal(collector.signals, sig) {
+		collector.signals = append(collector.signals, sig)
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package rfsb
+
+import (
+	"context"
+	"encoding/json"
+	"sync/atomic"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	testConfigChanged   = RegisterSignal("TestConfigChanged")
+	testPackageUpgraded = RegisterSignal("TestPackageUpgraded")
+)
+
+// emittingResource emits the given custom signals when materialized
+type emittingResource struct {
+	ResourceMeta
+	signals []Signal
+}
+
+func (er *emittingResource) Materialize(ctx context.Context) error {
+	for _, sig := range er.signals {
+		if err := EmitSignal(ctx, sig); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestRegisterSignal(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, "TestConfigChanged", testConfigChanged.String())
+	assert.Equal(t, "TestPackageUpgraded", testPackageUpgraded.String())
+	assert.Panics(t, func() { RegisterSignal("TestConfigChanged") })
+	assert.Panics(t, func() { RegisterSignal("Materialized") })
+
+	var decoded Signal
+	require.NoError(t, json.Unmarshal([]byte(`"TestPackageUpgraded"`), &decoded))
+	assert.Equal(t, testPackageUpgraded, decoded)
+	assert.Error(t, json.Unmarshal([]byte(`"NotASignal"`), &decoded))
+}
+
+func TestEmitSignal(t *testing.T) {
+	t.Parallel()
+
+	assert.Error(t, EmitSignal(context.Background(), testConfigChanged))
+
+	rg := &ResourceGraph{KeepGoing: true}
+	config := &emittingResource{signals: []Signal{testConfigChanged, testConfigChanged, testPackageUpgraded}}
+	rg.Register("config", config)
+	onChange := &testResource{}
+	rg.When(config, testConfigChanged).Do("onChange", onChange)
+	onBoth := &testResource{}
+	rg.When(config, testConfigChanged, testPackageUpgraded, Materialized).Do("onBoth", onBoth)
+
+	quiet := &emittingResource{}
+	rg.Register("quiet", quiet)
+	onQuietChange := &testResource{}
+	rg.When(quiet, testConfigChanged).Do("onQuietChange", onQuietChange)
+
+	builtin := &emittingResource{signals: []Signal{Materialized}}
+	rg.Register("builtin", builtin)
+
+	report, err := rg.MaterializeWithReport(context.Background())
+	require.Error(t, err)
+	assert.Equal(t, int32(1), onChange.materialized)
+	assert.Equal(t, int32(1), onBoth.materialized)
+	assert.Equal(t, int32(0), onQuietChange.materialized)
+	assert.Equal(t, []Signal{testConfigChanged, testPackageUpgraded}, report.Resources[0].Signals)
+	assert.Equal(t, Failed, report.Resources[5].Signal)
+}
+
+// failingEmitter emits testConfigChanged and then fails, on each of its first failures attempts
+type failingEmitter struct {
+	ResourceMeta
+	failures int
+	attempts int32
+}
+
+func (fe *failingEmitter) Materialize(ctx context.Context) error {
+	if int(atomic.AddInt32(&fe.attempts, 1)) > fe.failures {
+		return nil
+	}
+	if err := EmitSignal(ctx, testConfigChanged); err != nil {
+		return err
+	}
+	return errors.New("failed after emitting")
+}
+
+func TestEmitSignalFailure(t *testing.T) {
+	t.Parallel()
+
+	rg := &ResourceGraph{KeepGoing: true}
+	fails := &failingEmitter{failures: 1}
+	rg.Register("fails", fails)
+	afterFails := &testResource{}
+	rg.When(fails, testConfigChanged).Do("afterFails", afterFails)
+	retried := &failingEmitter{failures: 1}
+	retried.Retry = RetryPolicy{MaxAttempts: 2}
+	rg.Register("retried", retried)
+	afterRetried := &testResource{}
+	rg.When(retried, testConfigChanged).Do("afterRetried", afterRetried)
+
+	report, err := rg.MaterializeWithReport(context.Background())
+	require.Error(t, err)
+	assert.Equal(t, int32(0), afterFails.materialized)
+	assert.Equal(t, Failed, report.Resources[0].Signal)
+	assert.Empty(t, report.Resources[0].Signals)
+
+	assert.Equal(t, int32(2), retried.attempts)
+	assert.Equal(t, Materialized, report.Resources[2].Signal)
+	assert.Empty(t, report.Resources[2].Signals)
+	assert.Equal(t, int32(0), afterRetried.materialized)
+}
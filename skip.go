@@ -30,3 +30,29 @@ func (sw *SkippingWrapper) ShouldSkip(ctx context.Context) (bool, error) {
 
 	return false, nil
 }
+
+// Fingerprint returns the fingerprint of the wrapped Resource, as the SkipFunc cannot be fingerprinted
+func (sw *SkippingWrapper) Fingerprint() (string, error) {
+	return fingerprint(sw.Resource)
+}
+
+// LockKeys returns the lock keys of the wrapped Resource, if it is a Locker
+func (sw *SkippingWrapper) LockKeys() []string {
+	if locker, ok := sw.Resource.(Locker); ok {
+		return locker.LockKeys()
+	}
+	return nil
+}
+
+// Diff returns the Diff of the wrapped Resource, if it is a Differ. Otherwise, it returns nil.
+func (sw *SkippingWrapper) Diff(ctx context.Context) (*Diff, error) {
+	if differ, ok := sw.Resource.(Differ); ok {
+		return differ.Diff(ctx)
+	}
+	return nil, nil
+}
+
+// meta returns the ResourceMeta of the wrapped Resource, so that settings like the RetryPolicy are respected
+func (sw *SkippingWrapper) meta() *ResourceMeta {
+	return metaOf(sw.Resource)
+}
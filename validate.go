@@ -0,0 +1,210 @@
+package rfsb
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ValidationError is returned by Validate when the ResourceGraph is not well formed. Each of the problems found is
+// included in Errors, and will be one of *CycleError, *UnregisteredDependencyError, *DuplicateNameError or
+// *ConflictError.
+type ValidationError struct {
+	Errors []error
+}
+
+func (ve *ValidationError) Error() string {
+	msgs := []string{}
+	for _, err := range ve.Errors {
+		msgs = append(msgs, err.Error())
+	}
+	return fmt.Sprintf("invalid resource graph: %s", strings.Join(msgs, "; "))
+}
+
+// CycleError describes a set of dependencies that can never be satisfied, as they depend on each other. The Path
+// starts and ends with the same Resource.
+type CycleError struct {
+	Path []Resource
+}
+
+func (ce *CycleError) Error() string {
+	names := []string{}
+	for _, r := range ce.Path {
+		names = append(names, describeResource(r))
+	}
+	return fmt.Sprintf("dependency cycle: %s", strings.Join(names, " -> "))
+}
+
+// UnregisteredDependencyError describes a dependency between two resources where one or both of the resources was
+// never passed to Register.
+type UnregisteredDependencyError struct {
+	From         Resource
+	To           Resource
+	Unregistered []Resource
+}
+
+func (ude *UnregisteredDependencyError) Error() string {
+	names := []string{}
+	for _, r := range ude.Unregistered {
+		names = append(names, describeResource(r))
+	}
+	return fmt.Sprintf("dependency from %s to %s refers to unregistered resources: %s",
+		describeResource(ude.From), describeResource(ude.To), strings.Join(names, ", "))
+}
+
+// DuplicateNameError describes a set of resources that share the same hierarchical name
+type DuplicateNameError struct {
+	Name      string
+	Resources []Resource
+}
+
+func (dne *DuplicateNameError) Error() string {
+	return fmt.Sprintf("%d resources registered with the name %q", len(dne.Resources), dne.Name)
+}
+
+// describeResource returns the name of the resource, falling back to its type for resources that were never named
+func describeResource(r Resource) string {
+	if r.Name() != "" {
+		return r.Name()
+	}
+	return fmt.Sprintf("<unnamed %T>", r)
+}
+
+// Validate checks the ResourceGraph for problems that would prevent it from being materialized correctly. It detects
+// dependency cycles (which would otherwise cause Materialize to block forever), dependencies on resources that were
+// never registered, resources whose hierarchical names collide, and Identifiable resources that manage the same object
+// in different ways. Other than adding inferred dependencies if AutoRequire is set, Validate does not modify the graph;
+// Identifiable resources that manage the same object in the same way are only merged by Materialize and Plan, once
+// the graph is valid (see Identifiable).
+//
+// If any problems are found, a *ValidationError is returned.
+func (rg *ResourceGraph) Validate() error {
+	errs := []error{}
+	errs = append(errs, rg.findConflicts()...)
+	if rg.AutoRequire {
+		rg.InferDependencies()
+	}
+	errs = append(errs, rg.findUnregisteredDependencies()...)
+	errs = append(errs, rg.findDuplicateNames()...)
+	errs = append(errs, rg.findCycles()...)
+	if len(errs) == 0 {
+		return nil
+	}
+	return &ValidationError{Errors: errs}
+}
+
+// resourceIndex returns a map from each registered resource to its position in the registration order
+func (rg *ResourceGraph) resourceIndex() map[Resource]int {
+	index := make(map[Resource]int, len(rg.resources))
+	for i, r := range rg.resources {
+		index[r] = i
+	}
+	return index
+}
+
+// sortedDependents returns the resources depending on the passed resource, in registration order. Unregistered
+// resources are omitted.
+func (rg *ResourceGraph) sortedDependents(index map[Resource]int, from Resource) []Resource {
+	tos := []Resource{}
+	for to := range rg.dependencies[from] {
+		if _, ok := index[to]; ok {
+			tos = append(tos, to)
+		}
+	}
+	sortByRegistration(index, tos)
+	return tos
+}
+
+// sortByRegistration sorts the resources in place by their position in the registration order
+func sortByRegistration(index map[Resource]int, resources []Resource) {
+	sort.Slice(resources, func(i, j int) bool { return index[resources[i]] < index[resources[j]] })
+}
+
+func (rg *ResourceGraph) findUnregisteredDependencies() []error {
+	index := rg.resourceIndex()
+	errs := []*UnregisteredDependencyError{}
+	for from, tos := range rg.dependencies {
+		for to := range tos {
+			unregistered := []Resource{}
+			if _, ok := index[from]; !ok {
+				unregistered = append(unregistered, from)
+			}
+			if _, ok := index[to]; !ok {
+				unregistered = append(unregistered, to)
+			}
+			if len(unregistered) != 0 {
+				errs = append(errs, &UnregisteredDependencyError{From: from, To: to, Unregistered: unregistered})
+			}
+		}
+	}
+	sort.Slice(errs, func(i, j int) bool { return errs[i].Error() < errs[j].Error() })
+
+	out := []error{}
+	for _, err := range errs {
+		out = append(out, err)
+	}
+	return out
+}
+
+func (rg *ResourceGraph) findDuplicateNames() []error {
+	byName := map[string][]Resource{}
+	names := []string{}
+	for _, r := range rg.resources {
+		if _, ok := byName[r.Name()]; !ok {
+			names = append(names, r.Name())
+		}
+		byName[r.Name()] = append(byName[r.Name()], r)
+	}
+
+	errs := []error{}
+	for _, name := range names {
+		if len(byName[name]) > 1 {
+			errs = append(errs, &DuplicateNameError{Name: name, Resources: byName[name]})
+		}
+	}
+	return errs
+}
+
+// findCycles walks the graph depth first, reporting a cycle for every back edge found
+func (rg *ResourceGraph) findCycles() []error {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	index := rg.resourceIndex()
+	state := make(map[Resource]int, len(rg.resources))
+	stack := []Resource{}
+	errs := []error{}
+
+	var visit func(r Resource)
+	visit = func(r Resource) {
+		state[r] = visiting
+		stack = append(stack, r)
+		for _, to := range rg.sortedDependents(index, r) {
+			switch state[to] {
+			case unvisited:
+				visit(to)
+			case visiting:
+				path := []Resource{}
+				for i := len(stack) - 1; i >= 0; i-- {
+					if stack[i] == to {
+						path = append(path, stack[i:]...)
+						break
+					}
+				}
+				path = append(path, to)
+				errs = append(errs, &CycleError{Path: path})
+			}
+		}
+		stack = stack[:len(stack)-1]
+		state[r] = visited
+	}
+
+	for _, r := range rg.resources {
+		if state[r] == unvisited {
+			visit(r)
+		}
+	}
+	return errs
+}
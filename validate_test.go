@@ -0,0 +1,195 @@
+package rfsb
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateValidGraph(t *testing.T) {
+	t.Parallel()
+
+	rg := &ResourceGraph{}
+	r1 := mkArbitraryResource(t)
+	r2 := mkArbitraryResource(t)
+	rg.Register("r1", r1)
+	rg.When(r1).Do("r2", r2)
+
+	assert.NoError(t, rg.Validate())
+}
+
+func TestValidateCycle(t *testing.T) {
+	t.Parallel()
+
+	rg := &ResourceGraph{}
+	r1 := mkArbitraryResource(t)
+	r2 := mkArbitraryResource(t)
+	r3 := mkArbitraryResource(t)
+	rg.Register("r1", r1)
+	rg.When(r1).Do("r2", r2)
+	rg.When(r2).Do("r3", r3)
+	rg.RegisterDependency(r3, Evaluated, r1)
+
+	err := rg.Validate()
+	require.IsType(t, &ValidationError{}, err)
+	errs := err.(*ValidationError).Errors
+	require.Len(t, errs, 1)
+	require.IsType(t, &CycleError{}, errs[0])
+	assert.Equal(t, []Resource{r1, r2, r3, r1}, errs[0].(*CycleError).Path)
+
+	err = rg.Materialize(context.Background())
+	assert.IsType(t, &ValidationError{}, err)
+}
+
+func TestValidateUnregisteredDependency(t *testing.T) {
+	t.Parallel()
+
+	rg := &ResourceGraph{}
+	registered := mkArbitraryResource(t)
+	unregistered := mkArbitraryResource(t)
+	rg.Register("registered", registered)
+	rg.RegisterDependency(unregistered, Evaluated, registered)
+
+	err := rg.Validate()
+	require.IsType(t, &ValidationError{}, err)
+	errs := err.(*ValidationError).Errors
+	require.Len(t, errs, 1)
+	require.IsType(t, &UnregisteredDependencyError{}, errs[0])
+	assert.Equal(t, []Resource{unregistered}, errs[0].(*UnregisteredDependencyError).Unregistered)
+}
+
+func TestValidateDuplicateNames(t *testing.T) {
+	t.Parallel()
+
+	inner := &ResourceGraph{}
+	inner.Register("file", mkArbitraryResource(t))
+
+	rg := &ResourceGraph{}
+	rg.Register("inner", inner)
+	rg.Register("inner·file", mkArbitraryResource(t))
+
+	err := rg.Validate()
+	require.IsType(t, &ValidationError{}, err)
+	errs := err.(*ValidationError).Errors
+	require.Len(t, errs, 1)
+	require.IsType(t, &DuplicateNameError{}, errs[0])
+	assert.Equal(t, "inner·file", errs[0].(*DuplicateNameError).Name)
+}
+
+func TestValidateConflictingResources(t *testing.T) {
+	t.Parallel()
+
+	first := &ResourceGraph{}
+	first.Register("sshd", &FileResource{Path: "/etc/ssh/sshd_config", Contents: "UseDNS no"})
+	second := &ResourceGraph{}
+	second.Register("sshd", &FileResource{Path: "/etc/ssh/sshd_config", Contents: "UseDNS yes"})
+
+	rg := &ResourceGraph{}
+	rg.Register("first", first)
+	rg.Register("second", second)
+
+	err := rg.Validate()
+	require.IsType(t, &ValidationError{}, err)
+	errs := err.(*ValidationError).Errors
+	require.Len(t, errs, 1)
+	require.IsType(t, &ConflictError{}, errs[0])
+	assert.Equal(t, "file:/etc/ssh/sshd_config", errs[0].(*ConflictError).Key)
+	assert.Equal(t, []FieldDiff{{Field: "Contents", Current: "UseDNS no", Desired: "UseDNS yes"}},
+		errs[0].(*ConflictError).Fields)
+	assert.Equal(t, `invalid resource graph: conflicting definitions of file:/etc/ssh/sshd_config by first·sshd and `+
+		`second·sshd: Contents: "UseDNS no" -> "UseDNS yes"`, err.Error())
+}
+
+func TestValidateMergesIdenticalResources(t *testing.T) {
+	t.Parallel()
+
+	mkMembership := func() *GroupMembershipResource {
+		return &GroupMembershipResource{GID: 1000, User: "lcm"}
+	}
+	first := &ResourceGraph{}
+	firstUser := &testResource{}
+	first.Register("user", firstUser)
+	firstMembership := mkMembership()
+	first.When(firstUser).Do("membership", firstMembership)
+
+	second := &ResourceGraph{}
+	secondUser := &testResource{}
+	second.Register("user", secondUser)
+	secondMembership := mkMembership()
+	second.When(secondUser).Do("membership", secondMembership)
+
+	rg := &ResourceGraph{}
+	rg.Register("first", first)
+	rg.Register("second", second)
+	after := &testResource{}
+	rg.When(secondMembership, Skipped).Do("after", after)
+
+	require.NoError(t, rg.Validate())
+	assert.Len(t, rg.Resources(), 7, "Validate should not merge resources")
+	require.NoError(t, rg.validateAndMerge())
+	assert.Equal(t, []Resource{firstUser, firstMembership, first, secondUser, second, after}, rg.Resources())
+	assert.Equal(t, []Edge{
+		{From: firstUser, To: firstMembership, Signals: []Signal{Evaluated}},
+		{From: secondUser, To: firstMembership, Signals: []Signal{Evaluated}},
+	}, rg.Dependencies(firstMembership))
+	assert.Equal(t, []Edge{{From: firstMembership, To: after, Signals: []Signal{Skipped}}}, rg.Dependencies(after))
+	assert.Equal(t, []Resource{secondUser, firstMembership}, second.resources)
+}
+
+func TestValidateMergesResourcesWithDifferentMeta(t *testing.T) {
+	t.Parallel()
+
+	first := &FileResource{Path: "/etc/motd", Mode: 0644, Contents: "hello"}
+	first.Tags = []string{"motd"}
+	second := &FileResource{Path: "/etc/motd", Mode: 0644, Contents: "hello"}
+	second.Priority = 10
+
+	second.Tags = []string{"banner"}
+
+	rg := &ResourceGraph{Selector: &Selector{Tags: []string{"banner"}}}
+	rg.Register("first", first)
+	rg.Register("second", second)
+
+	require.NoError(t, rg.validateAndMerge())
+	assert.Equal(t, []Resource{first}, rg.Resources())
+	assert.Equal(t, []string{"motd"}, first.Tags)
+	assert.Equal(t, 0, first.Priority)
+	merged, ok := rg.Lookup("second")
+	assert.True(t, ok)
+	assert.Equal(t, first, merged)
+	assert.Equal(t, []Resource{first}, rg.selectedResources())
+}
+
+func TestValidateDoesNotMergeInvalidGraphs(t *testing.T) {
+	t.Parallel()
+
+	rg := &ResourceGraph{}
+	rg.Register("first", &FileResource{Path: "/etc/motd", Contents: "hello"})
+	rg.Register("second", &FileResource{Path: "/etc/motd", Contents: "hello"})
+	rg.Register("conflicting", &FileResource{Path: "/etc/issue", Contents: "hello"})
+	rg.Register("other", &FileResource{Path: "/etc/issue", Contents: "goodbye"})
+
+	require.IsType(t, &ValidationError{}, rg.validateAndMerge())
+	assert.Len(t, rg.Resources(), 4)
+}
+
+func TestValidateMergesDependentResources(t *testing.T) {
+	t.Parallel()
+
+	first := &FileResource{Path: "/etc/motd", Contents: "hello"}
+	second := &FileResource{Path: "/etc/motd", Contents: "hello"}
+	before := &testResource{}
+	rg := &ResourceGraph{}
+	rg.Register("before", before)
+	rg.When(before).Do("first", first)
+	rg.When(first).Do("second", second)
+
+	require.NoError(t, rg.validateAndMerge())
+	assert.Equal(t, []Resource{before, first}, rg.Resources())
+	assert.Equal(t, []Edge{{From: before, To: first, Signals: []Signal{Evaluated}}}, rg.Dependencies(first))
+	assert.Empty(t, rg.Dependents(first))
+	met, _, _ := rg.checkRequirements(first, map[Resource][]Signal{before: {Evaluated}}, map[Resource]bool{before: true})
+	assert.True(t, met, "the merged resource should not wait for itself")
+}